@@ -91,20 +91,29 @@ type usesSdk struct {
 	MinSDKVersion string   `xml:"minSdkVersion,attr"`
 }
 
-func parseAPKInfo(apkPath string) (ApkInfo, error) {
+// readManifest returns the decoded AndroidManifest.xml of the APK.
+func readManifest(apkPath string) (bytes.Buffer, error) {
 	var manifestContent bytes.Buffer
 	enc := xml.NewEncoder(&manifestContent)
 	enc.Indent("", "\t")
 
 	zipErr, resErr, manErr := apkparser.ParseApk(apkPath, enc)
 	if zipErr != nil {
-		return ApkInfo{}, fmt.Errorf("failed to unzip the APK, error: %s", zipErr)
+		return bytes.Buffer{}, fmt.Errorf("failed to unzip the APK, error: %s", zipErr)
 	}
 	if resErr != nil {
-		return ApkInfo{}, fmt.Errorf("failed to parse resources, error: %s", zipErr)
+		return bytes.Buffer{}, fmt.Errorf("failed to parse resources, error: %s", resErr)
 	}
 	if manErr != nil {
-		return ApkInfo{}, fmt.Errorf("failed to parse AndroidManifest.xml, error: %s", zipErr)
+		return bytes.Buffer{}, fmt.Errorf("failed to parse AndroidManifest.xml, error: %s", manErr)
+	}
+	return manifestContent, nil
+}
+
+func parseAPKInfo(apkPath string) (ApkInfo, error) {
+	manifestContent, err := readManifest(apkPath)
+	if err != nil {
+		return ApkInfo{}, err
 	}
 
 	var manifest manifest
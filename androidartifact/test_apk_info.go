@@ -0,0 +1,129 @@
+package androidartifact
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	// junit5Package is the package of the android-junit5 instrumentation library.
+	junit5Package = "de.mannodermaus.junit5"
+	// junit5BuilderDescriptor is the dex type descriptor of the JUnit 5 runner builder.
+	junit5BuilderDescriptor = "Lde/mannodermaus/junit5/AndroidJUnit5Builder;"
+)
+
+// MetaData is a <meta-data> entry of the manifest.
+type MetaData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// Instrumentation is an <instrumentation> declared in the manifest of a test APK.
+type Instrumentation struct {
+	Name          string     `xml:"name,attr"`
+	TargetPackage string     `xml:"targetPackage,attr"`
+	MetaData      []MetaData `xml:"meta-data"`
+}
+
+// TestApkInfo ...
+type TestApkInfo struct {
+	PackageName      string
+	Instrumentations []Instrumentation
+	// JUnit5 is true if the tests run on JUnit 5 through android-junit5.
+	JUnit5 bool
+}
+
+type testManifest struct {
+	XMLName          xml.Name          `xml:"manifest"`
+	PackageName      string            `xml:"package,attr"`
+	Instrumentations []Instrumentation `xml:"instrumentation"`
+	Application      struct {
+		MetaData []MetaData `xml:"meta-data"`
+	} `xml:"application"`
+}
+
+// declaresJUnit5 returns true if a meta-data of the manifest refers to android-junit5.
+func (m testManifest) declaresJUnit5() bool {
+	metaData := m.Application.MetaData
+	for _, instrumentation := range m.Instrumentations {
+		metaData = append(metaData, instrumentation.MetaData...)
+	}
+	for _, entry := range metaData {
+		if strings.HasPrefix(entry.Name, junit5Package) || strings.HasPrefix(entry.Value, junit5Package) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsJUnit5Builder returns true if a dex file of the APK contains the JUnit 5 runner builder class.
+func containsJUnit5Builder(apkPth string) (bool, error) {
+	reader, err := zip.OpenReader(apkPth)
+	if err != nil {
+		return false, fmt.Errorf("failed to unzip the APK, error: %s", err)
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			log.Warnf("Failed to close %s: %s", apkPth, err)
+		}
+	}()
+
+	for _, file := range reader.File {
+		if ok, _ := path.Match("classes*.dex", file.Name); !ok {
+			continue
+		}
+		dex, err := file.Open()
+		if err != nil {
+			return false, fmt.Errorf("failed to open %s, error: %s", file.Name, err)
+		}
+		content, err := ioutil.ReadAll(dex)
+		dex.Close()
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s, error: %s", file.Name, err)
+		}
+		if bytes.Contains(content, []byte(junit5BuilderDescriptor)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseTestManifest parses the package and the instrumentations from the decoded AndroidManifest.xml.
+func parseTestManifest(manifestContent []byte) (TestApkInfo, error) {
+	var manifest testManifest
+	if err := xml.Unmarshal(manifestContent, &manifest); err != nil {
+		return TestApkInfo{}, fmt.Errorf("failed to unmarshal AndroidManifest.xml, error: %s", err)
+	}
+
+	return TestApkInfo{
+		PackageName:      manifest.PackageName,
+		Instrumentations: manifest.Instrumentations,
+		JUnit5:           manifest.declaresJUnit5(),
+	}, nil
+}
+
+// GetTestAPKInfo returns the package and the instrumentations of an instrumentation test APK,
+// and whether its tests use JUnit 5, by the manifest's meta-data or the runner builder class in its dex files.
+// APKs without tests, e.g. the app under test, have no instrumentations.
+func GetTestAPKInfo(apkPth string) (TestApkInfo, error) {
+	manifestContent, err := readManifest(apkPth)
+	if err != nil {
+		return TestApkInfo{}, err
+	}
+	info, err := parseTestManifest(manifestContent.Bytes())
+	if err != nil || info.JUnit5 || len(info.Instrumentations) == 0 {
+		return info, err
+	}
+
+	if info.JUnit5, err = containsJUnit5Builder(apkPth); err != nil {
+		return TestApkInfo{}, err
+	}
+	return info, nil
+}
@@ -0,0 +1,132 @@
+package androidartifact
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_parseTestManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     TestApkInfo
+		wantErr  bool
+	}{
+		{
+			name: "test APK",
+			manifest: `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.login.test">
+	<uses-sdk android:minSdkVersion="21" android:targetSdkVersion="30"></uses-sdk>
+	<instrumentation android:label="Tests for com.example.login" android:name="androidx.test.runner.AndroidJUnitRunner" android:targetPackage="com.example.login" android:handleProfiling="false" android:functionalTest="false"></instrumentation>
+	<application android:debuggable="true"></application>
+</manifest>`,
+			want: TestApkInfo{
+				PackageName: "com.example.login.test",
+				Instrumentations: []Instrumentation{
+					{Name: "androidx.test.runner.AndroidJUnitRunner", TargetPackage: "com.example.login"},
+				},
+			},
+		},
+		{
+			name: "JUnit 5 meta-data",
+			manifest: `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.login.test">
+	<instrumentation android:name="androidx.test.runner.AndroidJUnitRunner" android:targetPackage="com.example.login">
+		<meta-data android:name="runnerBuilder" android:value="de.mannodermaus.junit5.AndroidJUnit5Builder"></meta-data>
+	</instrumentation>
+</manifest>`,
+			want: TestApkInfo{
+				PackageName: "com.example.login.test",
+				Instrumentations: []Instrumentation{
+					{
+						Name:          "androidx.test.runner.AndroidJUnitRunner",
+						TargetPackage: "com.example.login",
+						MetaData:      []MetaData{{Name: "runnerBuilder", Value: "de.mannodermaus.junit5.AndroidJUnit5Builder"}},
+					},
+				},
+				JUnit5: true,
+			},
+		},
+		{
+			name:     "app APK",
+			manifest: testArtifactAndroidManifest,
+			want:     TestApkInfo{PackageName: "com.example.birmachera.myapplication"},
+		},
+		{
+			name:     "invalid manifest",
+			manifest: "<manifest",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTestManifest([]byte(tt.manifest))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTestManifest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTestManifest() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_containsJUnit5Builder(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  bool
+	}{
+		{
+			name: "builder in a secondary dex",
+			files: map[string]string{
+				"classes.dex":  "dex\nLandroidx/test/runner/AndroidJUnitRunner;",
+				"classes2.dex": "dex\nLde/mannodermaus/junit5/AndroidJUnit5Builder;",
+			},
+			want: true,
+		},
+		{
+			name: "JUnit 4",
+			files: map[string]string{
+				"classes.dex":        "dex\nLandroidx/test/runner/AndroidJUnitRunner;",
+				"assets/builder.txt": "Lde/mannodermaus/junit5/AndroidJUnit5Builder;",
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apk := filepath.Join(t.TempDir(), "test.apk")
+			f, err := os.Create(apk)
+			if err != nil {
+				t.Fatalf("setup: failed to create APK, error: %s", err)
+			}
+			w := zip.NewWriter(f)
+			for name, content := range tt.files {
+				entry, err := w.Create(name)
+				if err != nil {
+					t.Fatalf("setup: failed to add %s, error: %s", name, err)
+				}
+				if _, err := entry.Write([]byte(content)); err != nil {
+					t.Fatalf("setup: failed to write %s, error: %s", name, err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("setup: failed to write APK, error: %s", err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatalf("setup: failed to close APK, error: %s", err)
+			}
+
+			got, err := containsJUnit5Builder(apk)
+			if err != nil {
+				t.Fatalf("containsJUnit5Builder() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("containsJUnit5Builder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
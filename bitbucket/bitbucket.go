@@ -0,0 +1,122 @@
+package bitbucket
+
+import (
+    "encoding/json"
+    "fmt"
+    "github.com/bitrise-io/go-steputils/stepconf"
+    "github.com/bitrise-io/go-utils/log"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/diff"
+    "io/ioutil"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+type BitbucketConfig struct {
+    Token          string    `env:"bitbucket_access_token,required"`
+    BaseURL        string    `env:"git_api_base_url"`
+    Owner          string    `env:"BITRISEIO_GIT_REPOSITORY_OWNER,required"`
+    Repo           string    `env:"BITRISEIO_GIT_REPOSITORY_SLUG,required"`
+    PullRequest    string    `env:"PULL_REQUEST_ID"`
+}
+
+const (
+    defaultBaseURL = "https://api.bitbucket.org/2.0"
+    filesPerPage   = 100
+)
+
+// ChangeSource lists the files changed by the pull request under test using the Bitbucket Cloud API.
+type ChangeSource struct {
+    cfg       BitbucketConfig
+    client    *http.Client
+}
+
+func NewChangeSource() (*ChangeSource, error) {
+    var cfg BitbucketConfig
+    if err := stepconf.Parse(&cfg); err != nil {
+        return nil, err
+    }
+    if cfg.BaseURL == "" {
+        cfg.BaseURL = defaultBaseURL
+    }
+    return &ChangeSource{cfg: cfg, client: http.DefaultClient}, nil
+}
+
+type diffStatPath struct {
+    Path    string    `json:"path"`
+}
+
+// diffStat is an entry of the pull request diffstat endpoint, old is nil for added files and new for removed ones.
+type diffStat struct {
+    Status    string           `json:"status"`
+    Old       *diffStatPath    `json:"old"`
+    New       *diffStatPath    `json:"new"`
+}
+
+type diffStatPage struct {
+    Values    []diffStat    `json:"values"`
+    Next      string        `json:"next"`
+}
+
+func (d diffStat) file() diff.File {
+    switch {
+    case d.New == nil && d.Old != nil:
+        return diff.File{Path: d.Old.Path, Status: diff.Removed}
+    case d.Old == nil && d.New != nil:
+        return diff.File{Path: d.New.Path, Status: diff.Added}
+    case d.Old != nil && d.Old.Path != d.New.Path:
+        return diff.File{Path: d.New.Path, PreviousPath: d.Old.Path, Status: diff.Renamed}
+    }
+    return diff.File{Path: d.New.Path, Status: diff.Modified}
+}
+
+// get fetches a page of the API, explaining the usual causes of failures.
+func (s *ChangeSource) get(u string, v interface{}) error {
+    req, err := http.NewRequest("GET", u, nil)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Authorization", "Bearer " + s.cfg.Token)
+
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    switch {
+    case resp.StatusCode == http.StatusUnauthorized:
+        return fmt.Errorf("%s, check bitbucket_access_token", resp.Status)
+    case resp.StatusCode == http.StatusNotFound:
+        return fmt.Errorf("%s, check the repository and that bitbucket_access_token can access it", resp.Status)
+    case resp.StatusCode >= 300:
+        body, _ := ioutil.ReadAll(resp.Body)
+        return fmt.Errorf("%s: %s", resp.Status, body)
+    }
+    return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (s *ChangeSource) ChangedFiles() ([]diff.File, error) {
+    if s.cfg.PullRequest == "" {
+        return nil, fmt.Errorf("PULL_REQUEST_ID is not set, the bitbucket change source only works in pull request builds, use the git change source otherwise")
+    }
+    number, err := strconv.Atoi(s.cfg.PullRequest)
+    if err != nil {
+        return nil, fmt.Errorf("invalid PULL_REQUEST_ID (%s): %s", s.cfg.PullRequest, err)
+    }
+
+    var changedFiles []diff.File
+    u := fmt.Sprintf("%s/repositories/%s/%s/pullrequests/%d/diffstat?pagelen=%d", strings.TrimSuffix(s.cfg.BaseURL, "/"), s.cfg.Owner, s.cfg.Repo, number, filesPerPage)
+    for page := 1; u != ""; page++ {
+        log.Printf("Fetching page %d ...", page)
+        var diffStats diffStatPage
+        if err := s.get(u, &diffStats); err != nil {
+            return nil, fmt.Errorf("failed to list the changes of pull request #%d of %s/%s: %s", number, s.cfg.Owner, s.cfg.Repo, err)
+        }
+        for _, d := range diffStats.Values {
+            changedFiles = append(changedFiles, d.file())
+        }
+        u = diffStats.Next
+    }
+    return changedFiles, nil
+}
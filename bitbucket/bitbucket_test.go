@@ -0,0 +1,50 @@
+package bitbucket
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/diff"
+    "github.com/stretchr/testify/require"
+)
+
+func TestChangedFiles(t *testing.T) {
+    var server *httptest.Server
+    server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        require.Equal(t, "/2.0/repositories/team/repo/pullrequests/3/diffstat", r.URL.Path)
+        require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+        switch r.URL.Query().Get("page") {
+        case "":
+            fmt.Fprintf(w, `{"values":[
+                {"status":"renamed","old":{"path":"features/a/Moved.kt"},"new":{"path":"features/b/Moved.kt"}},
+                {"status":"added","old":null,"new":{"path":"core/New.kt"}}
+            ],"next":"%s/2.0/repositories/team/repo/pullrequests/3/diffstat?pagelen=100&page=2"}`, server.URL)
+        case "2":
+            fmt.Fprint(w, `{"values":[
+                {"status":"removed","old":{"path":"core/Old.kt"},"new":null},
+                {"status":"modified","old":{"path":"app/build.gradle"},"new":{"path":"app/build.gradle"}}
+            ]}`)
+        }
+    }))
+    defer server.Close()
+
+    source := &ChangeSource{
+        cfg:    BitbucketConfig{Token: "secret", BaseURL: server.URL + "/2.0", Owner: "team", Repo: "repo", PullRequest: "3"},
+        client: server.Client(),
+    }
+    files, err := source.ChangedFiles()
+    require.NoError(t, err)
+    require.Equal(t, []diff.File{
+        {Path: "features/b/Moved.kt", PreviousPath: "features/a/Moved.kt", Status: diff.Renamed},
+        {Path: "core/New.kt", Status: diff.Added},
+        {Path: "core/Old.kt", Status: diff.Removed},
+        {Path: "app/build.gradle", Status: diff.Modified},
+    }, files)
+
+    source.cfg.PullRequest = ""
+    _, err = source.ChangedFiles()
+    require.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package changes
+
+import (
+    "encoding/json"
+    "fmt"
+    "github.com/bitrise-io/go-utils/log"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/diff"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "regexp"
+)
+
+type CacheConfig struct {
+    Dir       string    `env:"change_cache_dir"`
+    Commit    string    `env:"BITRISE_GIT_COMMIT"`
+}
+
+var unsafeNameRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// cachePath returns the file caching the changed files of a pull request at a commit.
+func cachePath(dir, source, pullRequest, commit string) string {
+    if dir == "" {
+        dir = filepath.Join(os.TempDir(), "build-module")
+    }
+    name := fmt.Sprintf("changes-%s-%s-%s.json", source, pullRequest, commit)
+    return filepath.Join(dir, unsafeNameRegexp.ReplaceAllString(name, "_"))
+}
+
+// cachingProvider reuses the changed files listed by a previous run of the step in the same build,
+// e.g. one per module, sparing the API calls.
+type cachingProvider struct {
+    provider    ChangedFilesProvider
+    path        string
+}
+
+func (c cachingProvider) ChangedFiles() ([]diff.File, error) {
+    if content, err := ioutil.ReadFile(c.path); err == nil {
+        var files []diff.File
+        if err = json.Unmarshal(content, &files); err == nil {
+            log.Infof("Reusing the changed files listed by a previous step from %s", c.path)
+            return files, nil
+        }
+        log.Warnf("Ignoring the invalid changed files cache %s: %s", c.path, err)
+    }
+
+    files, err := c.provider.ChangedFiles()
+    if err != nil {
+        return nil, err
+    }
+    if err := c.store(files); err != nil {
+        log.Warnf("Failed to cache the changed files: %s", err)
+    }
+    return files, nil
+}
+
+// store writes the cache through a temporary file, so that steps running in parallel never read a partial one.
+func (c cachingProvider) store(files []diff.File) error {
+    content, err := json.Marshal(files)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+        return err
+    }
+    tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path))
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := tmp.Write(content); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,66 @@
+package changes
+
+import (
+    "bytes"
+    "errors"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/bitrise-io/go-utils/log"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/diff"
+    "github.com/stretchr/testify/require"
+)
+
+type countingProvider struct {
+    calls    int
+    files    []diff.File
+    err      error
+}
+
+func (p *countingProvider) ChangedFiles() ([]diff.File, error) {
+    p.calls++
+    return p.files, p.err
+}
+
+func TestCachingProvider(t *testing.T) {
+    dir, err := ioutil.TempDir("", "changes")
+    require.NoError(t, err)
+    defer os.RemoveAll(dir)
+
+    pth := cachePath(dir, "github", "12", "abc/123")
+    require.Equal(t, filepath.Join(dir, "changes-github-12-abc_123.json"), pth)
+
+    failing := &countingProvider{err: errors.New("rate limited")}
+    _, err = cachingProvider{provider: failing, path: pth}.ChangedFiles()
+    require.EqualError(t, err, "rate limited")
+    require.NoFileExists(t, pth)
+
+    files := []diff.File{
+        {Path: "features/b/Moved.kt", PreviousPath: "features/a/Moved.kt", Status: diff.Renamed},
+        {Path: "core/Core.kt", Status: diff.Modified},
+    }
+    first := &countingProvider{files: files}
+    listed, err := cachingProvider{provider: first, path: pth}.ChangedFiles()
+    require.NoError(t, err)
+    require.Equal(t, files, listed)
+
+    second := &countingProvider{}
+    cached, err := cachingProvider{provider: second, path: pth}.ChangedFiles()
+    require.NoError(t, err)
+    require.Equal(t, files, cached)
+    require.Equal(t, 1, first.calls)
+    require.Equal(t, 0, second.calls)
+
+    var out bytes.Buffer
+    log.SetOutWriter(&out)
+    defer log.SetOutWriter(os.Stdout)
+    require.NoError(t, ioutil.WriteFile(pth, []byte("{"), 0644))
+    third := &countingProvider{files: files}
+    listed, err = cachingProvider{provider: third, path: pth}.ChangedFiles()
+    require.NoError(t, err)
+    require.Equal(t, files, listed)
+    require.Equal(t, 1, third.calls)
+    require.Contains(t, out.String(), "Ignoring the invalid changed files cache " + pth + ": unexpected end of JSON input")
+}
@@ -0,0 +1,233 @@
+package changes
+
+import (
+    "fmt"
+    "github.com/bitrise-io/go-steputils/stepconf"
+    "github.com/bitrise-io/go-utils/log"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/bitbucket"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/diff"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/execmd"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gh"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gitdiff"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gitlab"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/modules"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/util"
+    "net/url"
+    "sort"
+    "strings"
+)
+
+type ChangeConfig struct {
+    Source               string    `env:"change_source,opt[auto,github,gitlab,bitbucket,git]"`
+    RepositoryURL        string    `env:"GIT_REPOSITORY_URL"`
+    PullRequest          string    `env:"PULL_REQUEST_ID"`
+    TrackDependencies    bool      `env:"track_module_dependencies,required"`
+    RunAllPaths          string    `env:"run_all_paths"`
+    IncludePaths         string    `env:"include_paths"`
+    IgnorePaths          string    `env:"ignore_paths"`
+}
+
+// envChangedModules lists the changed modules, one per line, for the following steps.
+const envChangedModules = "BUILD_MODULE_CHANGED_MODULES"
+
+// AllModules is the key marking every module as changed, e.g. when the build configuration changed.
+const AllModules = "*"
+
+// ModuleChange counts the changed files of a module by their status.
+// It is empty for modules only affected through their dependencies.
+type ModuleChange map[diff.Status]int
+
+// Types returns the statuses of the changed files of the module.
+func (c ModuleChange) Types() []diff.Status {
+    var types []diff.Status
+    for _, status := range diff.Statuses {
+        if c[status] > 0 {
+            types = append(types, status)
+        }
+    }
+    return types
+}
+
+func (c ModuleChange) String() string {
+    var types []string
+    for _, status := range c.Types() {
+        types = append(types, fmt.Sprintf("%s %d", status, c[status]))
+    }
+    if len(types) == 0 {
+        return "dependency"
+    }
+    return strings.Join(types, ", ")
+}
+
+// ModuleSet is the set of changed modules, with the changes of each.
+type ModuleSet map[string]ModuleChange
+
+func (s ModuleSet) add(module string, status diff.Status) {
+    if s[module] == nil {
+        s[module] = ModuleChange{}
+    }
+    s[module][status]++
+}
+
+// Contains reports whether the module is changed, either directly or because all modules are.
+func (s ModuleSet) Contains(module string) bool {
+    _, changed := s[module]
+    _, all := s[AllModules]
+    return changed || all
+}
+
+// Modules returns the changed modules in alphabetical order.
+func (s ModuleSet) Modules() []string {
+    var list []string
+    for module := range s {
+        list = append(list, module)
+    }
+    sort.Strings(list)
+    return list
+}
+
+// ChangedFilesProvider lists the files touched by the change under test.
+type ChangedFilesProvider interface {
+    ChangedFiles() ([]diff.File, error)
+}
+
+func NewProvider(name string) (ChangedFilesProvider, error) {
+    switch name {
+    case "github":
+        return gh.NewChangeSource()
+    case "gitlab":
+        return gitlab.NewChangeSource()
+    case "bitbucket":
+        return bitbucket.NewChangeSource()
+    case "git":
+        return gitdiff.NewChangeSource()
+    }
+    return nil, fmt.Errorf("unknown change source: %s", name)
+}
+
+// repositoryHost returns the host of a git remote URL, either URL (`https://host/owner/repo.git`) or scp-like (`git@host:owner/repo.git`).
+func repositoryHost(repositoryURL string) string {
+    if strings.Contains(repositoryURL, "://") {
+        if u, err := url.Parse(repositoryURL); err == nil {
+            return u.Hostname()
+        }
+        return ""
+    }
+    host := repositoryURL[strings.LastIndex(repositoryURL, "@") + 1:]
+    if i := strings.Index(host, ":"); i >= 0 {
+        return host[:i]
+    }
+    return ""
+}
+
+// detectProvider selects the provider from the Bitrise git environment: the git diff for builds without a pull request,
+// otherwise the API of the host of GIT_REPOSITORY_URL.
+func detectProvider(repositoryURL, pullRequest string) (string, error) {
+    if pullRequest == "" {
+        return "git", nil
+    }
+    host := strings.ToLower(repositoryHost(repositoryURL))
+    for _, provider := range []string{"github", "gitlab", "bitbucket"} {
+        if strings.Contains(host, provider) {
+            return provider, nil
+        }
+    }
+    return "", fmt.Errorf("can't tell the git provider of %s, set change_source", repositoryURL)
+}
+
+// moduleChanges maps the kept paths of the files to their modules.
+// A file moved from one module to another changes both, the previous module lost it.
+func moduleChanges(layout *modules.Layout, files []diff.File, isKept map[string]bool, runAllPatterns []string) ModuleSet {
+    modulesChanged := ModuleSet{}
+    for _, file := range files {
+        for _, pth := range file.Paths() {
+            if !isKept[pth] {
+                continue
+            }
+            if pattern, ok := firstMatch(runAllPatterns, pth); ok && !modulesChanged.Contains(AllModules) {
+                log.Warnf("%s matches %s, all modules are affected", pth, pattern)
+                modulesChanged.add(AllModules, file.Status)
+            }
+            modulesChanged.add(layout.ModuleForFile(pth), file.Status)
+        }
+    }
+    return modulesChanged
+}
+
+func GetChangedModules(layout *modules.Layout) (ModuleSet, error) {
+    var cfg ChangeConfig
+    if err := stepconf.Parse(&cfg); err != nil {
+        return nil, util.ConfigErrorf("Issue with an input: %s", err)
+    }
+
+    if cfg.Source == "auto" {
+        provider, err := detectProvider(cfg.RepositoryURL, cfg.PullRequest)
+        if err != nil {
+            return nil, util.ConfigErrorf("Issue with an input: %s", err)
+        }
+        log.Infof("Change source: %s", provider)
+        cfg.Source = provider
+    }
+    source, err := NewProvider(cfg.Source)
+    if err != nil {
+        return nil, util.ConfigErrorf("Issue with an input: %s", err)
+    }
+
+    var cacheCfg CacheConfig
+    if err := stepconf.Parse(&cacheCfg); err != nil {
+        return nil, util.ConfigErrorf("Issue with an input: %s", err)
+    }
+    if cfg.Source != "git" && cfg.PullRequest != "" && cacheCfg.Commit != "" {
+        source = cachingProvider{provider: source, path: cachePath(cacheCfg.Dir, cfg.Source, cfg.PullRequest, cacheCfg.Commit)}
+    }
+
+    files, err := source.ChangedFiles()
+    if err != nil {
+        return nil, util.Errorf(util.FailureChanges, "Failed to list changed files from %s: %s", cfg.Source, err)
+    }
+
+    var paths []string
+    for _, file := range files {
+        paths = append(paths, file.Paths()...)
+    }
+    kept, dropped := newPathFilter(cfg.IncludePaths, cfg.IgnorePaths).apply(layout, paths)
+    if len(dropped) > 0 {
+        fmt.Println("Ignored changes:")
+        for file, reason := range dropped {
+            fmt.Println(" - [", file, "]", reason)
+        }
+    }
+    isKept := map[string]bool{}
+    for _, pth := range kept {
+        isKept[pth] = true
+    }
+
+    modulesChanged := moduleChanges(layout, files, isKept, parseGlobs(cfg.RunAllPaths))
+
+    fmt.Println("Changes detected in:")
+    for _, module := range modulesChanged.Modules() {
+        fmt.Println(" - [", module, "]", modulesChanged[module])
+    }
+
+    if cfg.TrackDependencies && !modulesChanged.Contains(AllModules) {
+        if graph := layout.Graph(); graph != nil {
+            fmt.Println("Modules affected through their dependencies:")
+            changed := map[string]bool{}
+            for module := range modulesChanged {
+                changed[module] = true
+            }
+            for module := range graph.Affected(changed) {
+                if modulesChanged[module] == nil {
+                    modulesChanged[module] = ModuleChange{}
+                }
+            }
+        } else {
+            log.Warnf("No module dependency graph, dependent modules won't be marked as changed")
+        }
+    }
+
+    if err := execmd.ExportEnv(envChangedModules, strings.Join(modulesChanged.Modules(), "\n")); err != nil {
+        return nil, err
+    }
+    return modulesChanged, nil
+}
@@ -0,0 +1,65 @@
+package changes
+
+import (
+    "testing"
+
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/diff"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/modules"
+    "github.com/stretchr/testify/require"
+)
+
+func TestModuleChanges(t *testing.T) {
+    layout, err := modules.NewLayout("features/{name} => feature-{name}", nil)
+    require.NoError(t, err)
+
+    files := []diff.File{
+        {Path: "features/b/src/main/Moved.kt", PreviousPath: "features/a/src/main/Moved.kt", Status: diff.Renamed},
+        {Path: "features/a/src/main/Old.kt", Status: diff.Removed},
+        {Path: "features/c/src/main/New.kt", Status: diff.Added},
+        {Path: "features/c/src/main/C.kt", Status: diff.Modified},
+        {Path: "features/d/README.md", Status: diff.Modified},
+    }
+    isKept := map[string]bool{}
+    for _, file := range files {
+        for _, pth := range file.Paths() {
+            isKept[pth] = pth != "features/d/README.md"
+        }
+    }
+
+    changed := moduleChanges(layout, files, isKept, nil)
+    require.Equal(t, ModuleSet{
+        "feature-a": {diff.Renamed: 1, diff.Removed: 1},
+        "feature-b": {diff.Renamed: 1},
+        "feature-c": {diff.Added: 1, diff.Modified: 1},
+    }, changed)
+    require.Equal(t, []string{"feature-a", "feature-b", "feature-c"}, changed.Modules())
+    require.Equal(t, []diff.Status{diff.Removed, diff.Renamed}, changed["feature-a"].Types())
+    require.Equal(t, "added 1, modified 1", changed["feature-c"].String())
+    require.True(t, changed.Contains("feature-a"))
+    require.False(t, changed.Contains("feature-d"))
+
+    changed = moduleChanges(layout, files, isKept, []string{"features/c/src/main/New.kt"})
+    require.True(t, changed.Contains("feature-d"))
+    require.Equal(t, "dependency", ModuleChange{}.String())
+}
+
+func TestDetectProvider(t *testing.T) {
+    for repositoryURL, provider := range map[string]string{
+        "git@github.com:owner/repo.git":                    "github",
+        "https://github.example.com/owner/repo.git":        "github",
+        "https://gitlab.com/group/sub/repo.git":            "gitlab",
+        "ssh://git@gitlab.example.com:2222/group/repo.git": "gitlab",
+        "git@bitbucket.org:team/repo.git":                  "bitbucket",
+    } {
+        detected, err := detectProvider(repositoryURL, "12")
+        require.NoError(t, err)
+        require.Equal(t, provider, detected, repositoryURL)
+    }
+
+    detected, err := detectProvider("git@github.com:owner/repo.git", "")
+    require.NoError(t, err)
+    require.Equal(t, "git", detected)
+
+    _, err = detectProvider("git@git.example.com:owner/repo.git", "12")
+    require.EqualError(t, err, "can't tell the git provider of git@git.example.com:owner/repo.git, set change_source")
+}
@@ -0,0 +1,82 @@
+package changes
+
+import (
+    "fmt"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/modules"
+    "regexp"
+    "strings"
+)
+
+// pathRules are the globs of an include or exclude list.
+// Global patterns are matched against the repository relative path, module patterns,
+// written as `[module] pattern`, against the path relative to the module directory.
+type pathRules struct {
+    global    []string
+    module    map[string][]string
+}
+
+var moduleRuleRegexp = regexp.MustCompile(`^\[\s*:?([^\]]+?)\s*\]\s*(.+)$`)
+
+func parsePathRules(list string) pathRules {
+    rules := pathRules{module: map[string][]string{}}
+    for _, pattern := range parseGlobs(list) {
+        if match := moduleRuleRegexp.FindStringSubmatch(pattern); match != nil {
+            rules.module[match[1]] = append(rules.module[match[1]], match[2])
+        } else {
+            rules.global = append(rules.global, pattern)
+        }
+    }
+    return rules
+}
+
+func (r pathRules) isEmpty(module string) bool {
+    return len(r.global) == 0 && len(r.module[module]) == 0
+}
+
+func (r pathRules) match(module, moduleDir, file string) (string, bool) {
+    if pattern, ok := firstMatch(r.global, file); ok {
+        return pattern, true
+    }
+    if relPath := strings.TrimPrefix(file, moduleDir + "/"); relPath != file {
+        if pattern, ok := firstMatch(r.module[module], relPath); ok {
+            return fmt.Sprintf("[%s] %s", module, pattern), true
+        }
+    }
+    return "", false
+}
+
+// pathFilter drops the changed files which should not cause a module to be tested, e.g. documentation.
+type pathFilter struct {
+    include    pathRules
+    exclude    pathRules
+}
+
+func newPathFilter(include, exclude string) pathFilter {
+    return pathFilter{
+        include: parsePathRules(include),
+        exclude: parsePathRules(exclude),
+    }
+}
+
+// apply returns the files to keep, and the reason of each dropped file.
+func (f pathFilter) apply(layout *modules.Layout, files []string) ([]string, map[string]string) {
+    var kept []string
+    dropped := map[string]string{}
+    for _, file := range files {
+        module := layout.ModuleForFile(file)
+        moduleDir := layout.DirForModule(module)
+
+        if !f.include.isEmpty(module) {
+            if _, ok := f.include.match(module, moduleDir, file); !ok {
+                dropped[file] = "not included"
+                continue
+            }
+        }
+        if pattern, ok := f.exclude.match(module, moduleDir, file); ok {
+            dropped[file] = "excluded by " + pattern
+            continue
+        }
+        kept = append(kept, file)
+    }
+    return kept, dropped
+}
@@ -0,0 +1,45 @@
+package changes
+
+import (
+    "testing"
+
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/modules"
+    "github.com/stretchr/testify/require"
+)
+
+func TestPathFilter(t *testing.T) {
+    layout, err := modules.NewLayout("features/{name} => feature-{name}", nil)
+    require.NoError(t, err)
+
+    filter := newPathFilter(`
+[feature-cards] src/**
+`, `
+**/*.md
+**/detekt-baseline.xml
+[feature-login] src/main/assets/**
+`)
+
+    kept, dropped := filter.apply(layout, []string{
+        "README.md",
+        "features/login/docs/Architecture.md",
+        "features/login/detekt-baseline.xml",
+        "features/login/src/main/assets/terms.html",
+        "features/login/src/main/Login.kt",
+        "features/cards/build.gradle",
+        "features/cards/src/main/Cards.kt",
+        "gradle/libs.versions.toml",
+    })
+
+    require.Equal(t, []string{
+        "features/login/src/main/Login.kt",
+        "features/cards/src/main/Cards.kt",
+        "gradle/libs.versions.toml",
+    }, kept)
+    require.Equal(t, map[string]string{
+        "README.md":                                 "excluded by **/*.md",
+        "features/login/docs/Architecture.md":       "excluded by **/*.md",
+        "features/login/detekt-baseline.xml":        "excluded by **/detekt-baseline.xml",
+        "features/login/src/main/assets/terms.html": "excluded by [feature-login] src/main/assets/**",
+        "features/cards/build.gradle":               "not included",
+    }, dropped)
+}
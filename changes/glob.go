@@ -0,0 +1,61 @@
+package changes
+
+import (
+    "path"
+    "strings"
+)
+
+// matchGlob reports whether a repository relative file path matches a glob pattern.
+// Patterns are matched against the whole path: `*`, `?` and `[...]` match within a single
+// path segment, while a `**` segment matches any number of directories.
+func matchGlob(pattern, file string) bool {
+    return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(file, "/"))
+}
+
+func matchSegments(pattern, file []string) bool {
+    for len(pattern) > 0 {
+        if pattern[0] == "**" {
+            if len(pattern) == 1 {
+                return true
+            }
+            for i := 0; i <= len(file); i++ {
+                if matchSegments(pattern[1:], file[i:]) {
+                    return true
+                }
+            }
+            return false
+        }
+
+        if len(file) == 0 {
+            return false
+        }
+        if ok, _ := path.Match(pattern[0], file[0]); !ok {
+            return false
+        }
+        pattern, file = pattern[1:], file[1:]
+    }
+    return len(file) == 0
+}
+
+// parseGlobs splits a newline separated list of patterns, skipping empty lines and `#` comments.
+func parseGlobs(list string) []string {
+    var patterns []string
+    for _, line := range strings.Split(list, "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        patterns = append(patterns, line)
+    }
+    return patterns
+}
+
+// firstMatch returns the first pattern matching the file.
+func firstMatch(patterns []string, file string) (string, bool) {
+    for _, pattern := range patterns {
+        if matchGlob(pattern, file) {
+            return pattern, true
+        }
+    }
+    return "", false
+}
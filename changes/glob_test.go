@@ -0,0 +1,30 @@
+package changes
+
+import (
+    "testing"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestMatchGlob(t *testing.T) {
+    tests := []struct {
+        pattern string
+        file    string
+        want    bool
+    }{
+        {pattern: "build.gradle", file: "build.gradle", want: true},
+        {pattern: "build.gradle", file: "features/login/build.gradle", want: false},
+        {pattern: "gradle/**", file: "gradle/libs.versions.toml", want: true},
+        {pattern: "gradle/**", file: "gradle/wrapper/gradle-wrapper.properties", want: true},
+        {pattern: "buildSrc/**", file: "buildSrc", want: true},
+        {pattern: "**/*.md", file: "README.md", want: true},
+        {pattern: "**/*.md", file: "features/login/docs/README.md", want: true},
+        {pattern: "features/*/detekt-baseline.xml", file: "features/login/detekt-baseline.xml", want: true},
+        {pattern: "features/*/detekt-baseline.xml", file: "features/login/config/detekt-baseline.xml", want: false},
+        {pattern: "**/src/test/**", file: "features/login/src/test/LoginTest.kt", want: true},
+        {pattern: "**/src/test/**", file: "features/login/src/main/Login.kt", want: false},
+    }
+    for _, tt := range tests {
+        require.Equal(t, tt.want, matchGlob(tt.pattern, tt.file), "%s ~ %s", tt.pattern, tt.file)
+    }
+}
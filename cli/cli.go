@@ -0,0 +1,117 @@
+package cli
+
+import (
+    "flag"
+    "fmt"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/util"
+    "io"
+    "os"
+    "reflect"
+    "strings"
+)
+
+// Command is a subcommand of the binary. Its flags set the environment variables read by its config structs,
+// so it runs the same code as the step.
+type Command struct {
+    Name       string
+    Args       string
+    Summary    string
+    Configs    []interface{}
+    Run        func(args []string) error
+}
+
+// envFlag sets an environment variable.
+type envFlag struct {
+    key       string
+    value     string
+    isBool    bool
+}
+
+func (f *envFlag) String() string {
+    if f == nil {
+        return ""
+    }
+    return f.value
+}
+
+func (f *envFlag) Set(value string) error {
+    f.value = value
+    return os.Setenv(f.key, value)
+}
+
+func (f *envFlag) IsBoolFlag() bool {
+    return f.isBool
+}
+
+// FlagName returns the flag setting an environment variable, e.g. `deploy-path` for deploy_path.
+func FlagName(key string) string {
+    return strings.ToLower(strings.Replace(key, "_", "-", -1))
+}
+
+// RegisterConfig adds a flag for every field of the config struct, setting the environment variable of its `env` tag.
+// Flags already registered by another config, e.g. deploy-path, are shared.
+func RegisterConfig(fs *flag.FlagSet, config interface{}) {
+    t := reflect.TypeOf(config)
+    if t.Kind() == reflect.Ptr {
+        t = t.Elem()
+    }
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        tag, ok := field.Tag.Lookup("env")
+        if !ok {
+            continue
+        }
+
+        parts := strings.SplitN(tag, ",", 2)
+        name := FlagName(parts[0])
+        if fs.Lookup(name) != nil {
+            continue
+        }
+        usage := "sets " + parts[0]
+        if len(parts) == 2 {
+            usage += fmt.Sprintf(" (%s)", parts[1])
+        }
+        fs.Var(&envFlag{key: parts[0], isBool: field.Type.Kind() == reflect.Bool}, name, usage)
+    }
+}
+
+// PrintUsage writes the list of commands.
+func PrintUsage(out io.Writer, program string, commands []Command) {
+    fmt.Fprintf(out, "Usage: %s <command> [flags] [args]\n\nCommands:\n", program)
+    for _, command := range commands {
+        fmt.Fprintf(out, "  %-16s %s\n", command.Name, command.Summary)
+    }
+    fmt.Fprintf(out, "\nRun `%s <command> -h` for the flags of a command.\n", program)
+}
+
+// Run runs the command named by the first argument with the rest of the arguments.
+func Run(program string, commands []Command, args []string) error {
+    if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+        PrintUsage(os.Stdout, program, commands)
+        return nil
+    }
+
+    for _, command := range commands {
+        if command.Name != args[0] {
+            continue
+        }
+
+        fs := flag.NewFlagSet(program + " " + command.Name, flag.ContinueOnError)
+        fs.Usage = func() {
+            fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] %s\n\n%s\n\nFlags:\n", program, command.Name, command.Args, command.Summary)
+            fs.PrintDefaults()
+        }
+        for _, config := range command.Configs {
+            RegisterConfig(fs, config)
+        }
+        if err := fs.Parse(args[1:]); err == flag.ErrHelp {
+            return nil
+        } else if err != nil {
+            return util.ConfigErrorf("%s", err)
+        }
+        return command.Run(fs.Args())
+    }
+
+    PrintUsage(os.Stderr, program, commands)
+    return util.ConfigErrorf("unknown command: %s", args[0])
+}
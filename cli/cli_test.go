@@ -0,0 +1,56 @@
+package cli
+
+import (
+    "os"
+    "testing"
+
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/util"
+    "github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+    Variant      string    `env:"variant,required"`
+    DeployDir    string    `env:"deploy_path"`
+    Offline      bool      `env:"gradle_offline"`
+    Internal     string
+}
+
+type otherConfig struct {
+    DeployPath    string    `env:"deploy_path,required"`
+    Source        string    `env:"change_source,opt[github,git]"`
+}
+
+func TestRun(t *testing.T) {
+    for _, key := range []string{"variant", "deploy_path", "gradle_offline", "change_source"} {
+        os.Unsetenv(key)
+    }
+
+    var got []string
+    commands := []Command{{
+        Name:    "build",
+        Configs: []interface{}{testConfig{}, &otherConfig{}},
+        Run: func(args []string) error {
+            got = args
+            return nil
+        },
+    }}
+
+    require.NoError(t, Run("step", commands, []string{"build", "-variant", "Debug", "-deploy-path=/tmp/deploy", "-gradle-offline", "-change-source", "git", "app", "lib"}))
+    require.Equal(t, []string{"app", "lib"}, got)
+    require.Equal(t, "Debug", os.Getenv("variant"))
+    require.Equal(t, "/tmp/deploy", os.Getenv("deploy_path"))
+    require.Equal(t, "true", os.Getenv("gradle_offline"))
+    require.Equal(t, "git", os.Getenv("change_source"))
+
+    err := Run("step", commands, []string{"build", "-internal", "x"})
+    require.Error(t, err)
+    require.Equal(t, util.FailureConfig, util.Reason(err))
+
+    err = Run("step", commands, []string{"deploy"})
+    require.EqualError(t, err, "unknown command: deploy")
+}
+
+func TestFlagName(t *testing.T) {
+    require.Equal(t, "deploy-path", FlagName("deploy_path"))
+    require.Equal(t, "bitrise-git-branch-dest", FlagName("BITRISE_GIT_BRANCH_DEST"))
+}
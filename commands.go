@@ -0,0 +1,152 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/androidartifact"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/bitbucket"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/changes"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/cli"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/deploy"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/execmd"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gh"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gitdiff"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gitlab"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gradle"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/modules"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/test"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/trigger"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/util"
+)
+
+// commands are the stages of the step which can be run on their own, e.g. against a local checkout.
+func commands() []cli.Command {
+    return []cli.Command{
+        {
+            Name:    "changed-modules",
+            Summary: "Lists the modules changed by the pull request or the commits under test.",
+            Configs: []interface{}{changes.ChangeConfig{}, gh.GitHubConfig{}, gitlab.GitLabConfig{}, bitbucket.BitbucketConfig{}, gitdiff.GitConfig{}, modules.LayoutConfig{}},
+            Run:     changedModulesCommand,
+        },
+        {
+            Name:    "build",
+            Args:    "<module>...",
+            Summary: "Builds the modules and copies their APKs into the deploy directory.",
+            Configs: []interface{}{gradle.BuildConfig{}, modules.LayoutConfig{}},
+            Run:     buildCommand,
+        },
+        {
+            Name:    "deploy",
+            Summary: "Uploads the content of the deploy directory and the test results.",
+            Configs: []interface{}{deploy.Config{}},
+            Run: func(args []string) error {
+                return util.Classify(util.FailureUpload, deploy.Deploy())
+            },
+        },
+        {
+            Name:    "trigger",
+            Summary: "Starts the workflows with the current values of the environments to share.",
+            Configs: []interface{}{trigger.Config{}},
+            Run: func(args []string) error {
+                return util.Classify(util.FailureTrigger, trigger.TriggerWorkflow())
+            },
+        },
+        {
+            Name:    "parse-tests",
+            Args:    "[test results dir]",
+            Summary: "Converts the test results of the directory, $BITRISE_TEST_DEPLOY_DIR by default, to JUnit XML.",
+            Run:     parseTestsCommand,
+        },
+        {
+            Name:    "apk-info",
+            Args:    "<apk>...",
+            Summary: "Prints the package name, version and SDK levels of the APKs.",
+            Run:     apkInfoCommand,
+        },
+    }
+}
+
+func changedModulesCommand(args []string) error {
+    layout, err := modules.LoadLayout()
+    if err != nil {
+        return err
+    }
+    changed, err := changes.GetChangedModules(layout)
+    if err != nil {
+        return util.Classify(util.FailureChanges, err)
+    }
+    for _, module := range changed.Modules() {
+        fmt.Printf("%s\t%s\n", module, changed[module])
+    }
+    return nil
+}
+
+func buildCommand(args []string) error {
+    if len(args) == 0 {
+        return util.ConfigErrorf("no module to build, list them after the flags")
+    }
+    layout, err := modules.LoadLayout()
+    if err != nil {
+        return err
+    }
+    if err := gradle.Assemble(args); err != nil {
+        return util.Classify(util.FailureBuild, err)
+    }
+    for _, module := range args {
+        outputs, err := gradle.PrepareForDeploy(layout, module)
+        if err != nil {
+            return util.Classify(util.FailureBuild, err)
+        }
+        fmt.Printf("%s: target=%s app=%s test=%s\n", module, outputs.TargetAPK, outputs.AppAPK, outputs.TestAPK)
+    }
+    return nil
+}
+
+func parseTestsCommand(args []string) error {
+    dir := os.Getenv("BITRISE_TEST_DEPLOY_DIR")
+    if len(args) > 0 {
+        dir = args[0]
+    }
+    if dir == "" {
+        return util.ConfigErrorf("no test results dir, pass it as argument or set BITRISE_TEST_DEPLOY_DIR")
+    }
+
+    results, err := test.ParseTestResults(dir)
+    if err != nil {
+        return fmt.Errorf("Failed to parse the test results in %s: %s", dir, err)
+    }
+    for _, result := range results {
+        fmt.Printf("=== %s (%s, %d images) ===\n", result.Name, result.StepInfo.ID, len(result.ImagePaths))
+        fmt.Println(string(result.XMLContent))
+    }
+    return nil
+}
+
+func apkInfoCommand(args []string) error {
+    if len(args) == 0 {
+        return util.ConfigErrorf("no APK, list them after the flags")
+    }
+    for _, apk := range args {
+        info, err := androidartifact.GetAPKInfo(apk)
+        if err != nil {
+            return fmt.Errorf("Failed to read %s: %s", apk, err)
+        }
+        info.RawPackageContent = ""
+        b, err := json.MarshalIndent(struct {
+            Path string `json:"path"`
+            androidartifact.ApkInfo
+        }{apk, info}, "", "  ")
+        if err != nil {
+            return err
+        }
+        fmt.Println(string(b))
+    }
+    return nil
+}
+
+// runCommand runs the binary as a command line tool, outside of a Bitrise build.
+func runCommand(args []string) error {
+    execmd.UseEnvman = false
+    return cli.Run("build-module", commands(), args)
+}
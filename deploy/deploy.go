@@ -4,19 +4,20 @@ import (
     "bytes"
     "fmt"
     "html/template"
-    "os"
     "path/filepath"
+    "sort"
     "strings"
 
     "github.com/bitrise-steplib/bitrise-step-build-router-start/test"
 
     "github.com/bitrise-io/envman/envman"
     "github.com/bitrise-io/go-steputils/stepconf"
-    "github.com/bitrise-io/go-steputils/tools"
     "github.com/bitrise-io/go-utils/log"
     "github.com/bitrise-io/go-utils/pathutil"
     "github.com/bitrise-io/go-utils/ziputil"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/execmd"
     "github.com/bitrise-steplib/bitrise-step-build-router-start/uploaders"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/util"
 )
 
 var fileBaseNamesToSkip = []string{".DS_Store"}
@@ -56,19 +57,14 @@ type ArtifactURLCollection struct {
 
 const zippedXcarchiveExt = ".xcarchive.zip"
 
-func fail(format string, v ...interface{}) {
-    log.Errorf(format, v...)
-    os.Exit(1)
-}
-
-func Deploy() {
+func Deploy() error {
     var config Config
     if err := stepconf.Parse(&config); err != nil {
-        fail("Issue with input: %s", err)
+        return util.ConfigErrorf("Issue with input: %s", err)
     }
 
     if err := validateGoTemplate(config.PublicInstallPageMapFormat); err != nil {
-        fail("PublicInstallPageMapFormat - %s", err)
+        return util.ConfigErrorf("PublicInstallPageMapFormat - %s", err)
     }
 
     stepconf.Print(config)
@@ -77,17 +73,17 @@ func Deploy() {
 
     absDeployPth, err := pathutil.AbsPath(config.DeployPath)
     if err != nil {
-        fail("Failed to expand path: %s, error: %s", config.DeployPath, err)
+        return fmt.Errorf("Failed to expand path: %s, error: %s", config.DeployPath, err)
     }
 
     tmpDir, err := pathutil.NormalizedOSTempDirPath("__deploy-to-bitrise-io__")
     if err != nil {
-        fail("Failed to create tmp dir, error: %s", err)
+        return fmt.Errorf("Failed to create tmp dir, error: %s", err)
     }
 
     filesToDeploy, err := collectFilesToDeploy(absDeployPth, config, tmpDir)
     if err != nil {
-        fail("%s", err)
+        return err
     }
     clearedFilesToDeploy := clearDeployFiles(filesToDeploy)
     fmt.Println()
@@ -99,23 +95,77 @@ func Deploy() {
 
     artifactURLCollection, err := deploy(clearedFilesToDeploy, config)
     if err != nil {
-        fail("%s", err)
+        return err
     }
     fmt.Println()
     log.Donef("Success")
     log.Printf("You can find the Artifact on Bitrise, on the Build's page: %s", config.BuildURL)
 
     if err := exportInstallPages(artifactURLCollection, config); err != nil {
-        fail("%s", err)
+        return err
     }
     deployTestResults(config)
+    return nil
+}
+
+// PlanFiles returns the files Deploy uploads, without uploading them.
+// pending are the files copied into the deploy directory before the upload, e.g. the APKs of the modules.
+func PlanFiles(pending []string) ([]string, error) {
+    var config Config
+    if err := stepconf.Parse(&config); err != nil {
+        return nil, util.ConfigErrorf("Issue with input: %s", err)
+    }
+
+    absDeployPth, err := pathutil.AbsPath(config.DeployPath)
+    if err != nil {
+        return nil, fmt.Errorf("Failed to expand path: %s, error: %s", config.DeployPath, err)
+    }
+    isDeployPathDir, err := pathutil.IsDirExists(absDeployPth)
+    if err != nil {
+        return nil, fmt.Errorf("failed to check if DeployPath (%s) is a directory or a file, error: %s", absDeployPth, err)
+    }
+
+    if !isDeployPathDir {
+        return []string{absDeployPth}, nil
+    }
+    if config.IsCompress == "true" {
+        zipName := filepath.Base(absDeployPth)
+        if config.ZipName != "" {
+            zipName = config.ZipName
+        }
+        return []string{zipName + ".zip"}, nil
+    }
+
+    pths, err := filepath.Glob(filepath.Join(absDeployPth, "*"))
+    if err != nil {
+        return nil, fmt.Errorf("failed to list files in DeployPath, error: %s", err)
+    }
+    for _, pth := range pending {
+        if pth, err = pathutil.AbsPath(pth); err == nil {
+            pths = append(pths, pth)
+        }
+    }
+    sort.Strings(pths)
+
+    var filesToDeploy []string
+    for i, pth := range pths {
+        if i > 0 && pths[i - 1] == pth {
+            continue
+        }
+        if isDir, err := pathutil.IsDirExists(pth); err != nil {
+            return nil, fmt.Errorf("failed to check if path (%s) is a directory or a file, error: %s", pth, err)
+        } else if !isDir {
+            filesToDeploy = append(filesToDeploy, pth)
+        }
+    }
+    return clearDeployFiles(filesToDeploy), nil
 }
 
 func exportInstallPages(artifactURLCollection ArtifactURLCollection, config Config) error {
     if len(artifactURLCollection.PublicInstallPageURLs) > 0 {
         pages := mapURLsToInstallPages(artifactURLCollection.PublicInstallPageURLs)
 
-        if err := tools.ExportEnvironmentWithEnvman("BITRISE_PUBLIC_INSTALL_PAGE_URL", pages[0].URL); err != nil {
+        if err := execmd.ExportEnv("BITRISE_PUBLIC_INSTALL_PAGE_URL", pages[0].URL); err != nil {
             return fmt.Errorf("failed to export BITRISE_PUBLIC_INSTALL_PAGE_URL: %s", err)
         }
         log.Printf("The public install page url is now available in the Environment Variable: BITRISE_PUBLIC_INSTALL_PAGE_URL (value: %s)\n", pages[0].URL)
@@ -174,7 +224,7 @@ func exportMapEnvironment(templateName string, format string, formatName string,
         log.Warnf("too many artifacts, not all urls has been written to output: %s", outputKey)
     }
 
-    return value, tools.ExportEnvironmentWithEnvman(outputKey, value)
+    return value, execmd.ExportEnv(outputKey, value)
 }
 
 func applyTemplateWithMaxSize(temp *template.Template, pages []PublicInstallPage, maxEnvLength int) (string, bool, error) {
@@ -0,0 +1,69 @@
+package diff
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Status is how a change touched a file.
+type Status string
+
+const (
+    Added       Status = "added"
+    Modified    Status = "modified"
+    Removed     Status = "removed"
+    Renamed     Status = "renamed"
+)
+
+// Statuses lists the statuses in the order they are reported.
+var Statuses = []Status{Added, Modified, Removed, Renamed}
+
+// File is a file touched by a change. PreviousPath is only set for renamed files.
+type File struct {
+    Path            string    `json:"path"`
+    PreviousPath    string    `json:"previous_path,omitempty"`
+    Status          Status    `json:"status"`
+}
+
+// Paths returns the paths touched by the change, a renamed file touches both its previous and its new path.
+func (f File) Paths() []string {
+    if f.PreviousPath != "" && f.PreviousPath != f.Path {
+        return []string{f.PreviousPath, f.Path}
+    }
+    return []string{f.Path}
+}
+
+// ParseGitStatus converts a `git diff --name-status` letter, or a GitHub file status, to a Status.
+// Copies are additions, type changes and other unknown statuses are modifications.
+func ParseGitStatus(status string) Status {
+    switch strings.ToLower(status) {
+    case "a", "added", "c", "copied":
+        return Added
+    case "d", "removed":
+        return Removed
+    case "r", "renamed":
+        return Renamed
+    }
+    return Modified
+}
+
+// ParseNameStatus parses the output of `git diff --name-status`, e.g. `R087\told/path\tnew/path`.
+func ParseNameStatus(out string) ([]File, error) {
+    var files []File
+    for _, line := range strings.Split(out, "\n") {
+        if strings.TrimSpace(line) == "" {
+            continue
+        }
+        fields := strings.Split(line, "\t")
+        if len(fields) < 2 || fields[0] == "" {
+            return nil, fmt.Errorf("invalid git diff line: %s", line)
+        }
+
+        file := File{Path: fields[len(fields) - 1], Status: ParseGitStatus(fields[0][:1])}
+        if len(fields) == 3 && file.Status == Renamed {
+            file.PreviousPath = fields[1]
+        }
+        files = append(files, file)
+    }
+    return files, nil
+}
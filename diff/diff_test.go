@@ -0,0 +1,27 @@
+package diff
+
+import (
+    "testing"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestParseNameStatus(t *testing.T) {
+    files, err := ParseNameStatus("M\tapp/build.gradle\nA\tcore/New.kt\nD\tcore/Old.kt\n" +
+        "R087\tfeatures/a/src/Moved.kt\tfeatures/b/src/Moved.kt\nC100\tcore/A.kt\tcore/B.kt\nT\tscript.sh\n")
+    require.NoError(t, err)
+    require.Equal(t, []File{
+        {Path: "app/build.gradle", Status: Modified},
+        {Path: "core/New.kt", Status: Added},
+        {Path: "core/Old.kt", Status: Removed},
+        {Path: "features/b/src/Moved.kt", PreviousPath: "features/a/src/Moved.kt", Status: Renamed},
+        {Path: "core/B.kt", Status: Added},
+        {Path: "script.sh", Status: Modified},
+    }, files)
+
+    require.Equal(t, []string{"features/a/src/Moved.kt", "features/b/src/Moved.kt"}, files[3].Paths())
+    require.Equal(t, []string{"core/Old.kt"}, files[2].Paths())
+
+    _, err = ParseNameStatus("garbage")
+    require.Error(t, err)
+}
@@ -3,44 +3,276 @@ package env
 import (
     "fmt"
     "os"
+    "path/filepath"
+    "strconv"
     "github.com/bitrise-io/go-steputils/stepconf"
     "github.com/bitrise-io/go-utils/log"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/androidartifact"
     "github.com/bitrise-steplib/bitrise-step-build-router-start/execmd"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gradle"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/instrument"
     "github.com/bitrise-steplib/bitrise-step-build-router-start/util"
 )
 
 type TargetConfig struct {
-    APK             string          `env:"target_apk,required"`
-    TestPackage     string          `env:"test_package,required"`
-    TestRunner      string          `env:"test_runner,required"`
-    JUnit5          bool            `env:"is_junit_5,required"`
-    Module          string          `env:"module,required"`
+    TestPackage         string          `env:"test_package"`
+    TestRunner          string          `env:"test_runner"`
+    JUnit5              bool            `env:"is_junit_5,required"`
+    Classes             string          `env:"instrumentation_class"`
+    Packages            string          `env:"instrumentation_package"`
+    Annotation          string          `env:"instrumentation_annotation"`
+    NotAnnotation       string          `env:"instrumentation_not_annotation"`
+    Size                string          `env:"instrumentation_size,opt[,small,medium,large]"`
+    NumShards           int             `env:"instrumentation_num_shards"`
+    ShardIndex          int             `env:"instrumentation_shard_index"`
+    ClearPackageData    bool            `env:"instrumentation_clear_package_data"`
+    Coverage            bool            `env:"instrumentation_coverage"`
+    Args                string          `env:"instrumentation_args"`
+    Shards              int             `env:"test_shards"`
 }
 
-func SetTargetEnv() {
-    log.Infof("=== Set target environment ===")
+const (
+    // defaultTestRunner is used when neither the input nor a test APK declares the runner.
+    defaultTestRunner = "androidx.test.runner.AndroidJUnitRunner"
+    // testAPKPlaceholder is planned for the values to read from a test APK which is not built yet.
+    testAPKPlaceholder = "<read from test APK>"
+)
+
+// findTestAPK returns the manifest of the module's instrumentation test APK:
+// the test APK, or the target APK of library modules which is the test APK itself.
+func findTestAPK(outputs gradle.Outputs) (androidartifact.TestApkInfo, bool) {
+    for _, apk := range []string{outputs.TestAPK, outputs.TargetAPK} {
+        if apk == "" {
+            continue
+        }
+        if _, err := os.Stat(apk); err != nil {
+            continue
+        }
+        info, err := androidartifact.GetTestAPKInfo(apk)
+        if err != nil {
+            log.Warnf("Failed to read the manifest of %s: %s", apk, err)
+            continue
+        }
+        if len(info.Instrumentations) > 0 {
+            return info, true
+        }
+    }
+    return androidartifact.TestApkInfo{}, false
+}
+
+// resolveTestTarget fills the test package and runner from the test APK's manifest, the inputs override them.
+// JUnit 5 support is always taken from the test APK when there is one.
+func resolveTestTarget(cfg TargetConfig, info androidartifact.TestApkInfo, found bool) (TargetConfig, error) {
+    if found {
+        runner := info.Instrumentations[0].Name
+        if len(info.Instrumentations) > 1 {
+            log.Warnf("The test APK declares %d instrumentations, using %s", len(info.Instrumentations), runner)
+        }
+        if cfg.TestPackage == "" {
+            cfg.TestPackage = info.PackageName
+        } else if cfg.TestPackage != info.PackageName {
+            log.Warnf("test_package (%s) differs from the package of the test APK (%s), using the input", cfg.TestPackage, info.PackageName)
+        }
+        if cfg.TestRunner == "" {
+            cfg.TestRunner = runner
+        } else if cfg.TestRunner != runner {
+            log.Warnf("test_runner (%s) differs from the instrumentation of the test APK (%s), using the input", cfg.TestRunner, runner)
+        }
+        // A runner builder missing from the APK fails the run, without it JUnit 5 tests are not run at all.
+        if info.JUnit5 && !cfg.JUnit5 {
+            log.Warnf("is_junit_5 is not set but the test APK uses JUnit 5, adding the JUnit 5 runner builder")
+        } else if !info.JUnit5 && cfg.JUnit5 {
+            log.Warnf("is_junit_5 is set but the test APK does not use JUnit 5, leaving out the JUnit 5 runner builder")
+        }
+        cfg.JUnit5 = info.JUnit5
+    }
+
+    if cfg.TestPackage == "" {
+        return TargetConfig{}, fmt.Errorf("test_package is not set and no test APK was found to read it from")
+    }
+    if cfg.TestRunner == "" {
+        cfg.TestRunner = defaultTestRunner
+    }
+    return cfg, nil
+}
+
+// instrumentCommand returns the instrumentation running the tests selected by the inputs.
+func instrumentCommand(cfg TargetConfig) (instrument.Command, error) {
+    args, err := instrument.ParseArgs(cfg.Args)
+    if err != nil {
+        return instrument.Command{}, err
+    }
+    command := instrument.Command{
+        TestPackage:      cfg.TestPackage,
+        Runner:           cfg.TestRunner,
+        Classes:          instrument.SplitList(cfg.Classes),
+        Packages:         instrument.SplitList(cfg.Packages),
+        Annotation:       cfg.Annotation,
+        NotAnnotation:    cfg.NotAnnotation,
+        Size:             cfg.Size,
+        NumShards:        cfg.NumShards,
+        ShardIndex:       cfg.ShardIndex,
+        ClearPackageData: cfg.ClearPackageData,
+        Coverage:         cfg.Coverage,
+        Args:             args,
+    }
+    if cfg.JUnit5 {
+        command.RunnerBuilder = instrument.JUnit5RunnerBuilder
+    }
+    return command, command.Validate()
+}
+
+// Variable is an environment variable exported for the triggered test workflows.
+type Variable struct {
+    Key      string    `json:"key"`
+    Value    string    `json:"value"`
+}
+
+// shardCommands splits the instrumentation into the given number of runs with the runner's numShards and shardIndex,
+// the command itself is the only run if there are less than two shards.
+func shardCommands(command instrument.Command, shards int) ([]instrument.Command, error) {
+    if shards < 0 {
+        return nil, fmt.Errorf("test_shards can't be negative")
+    }
+    if shards < 2 {
+        return []instrument.Command{command}, nil
+    }
+    if command.NumShards > 0 {
+        return nil, fmt.Errorf("test_shards can't be combined with instrumentation_num_shards")
+    }
+
+    var commands []instrument.Command
+    for i := 0; i < shards; i++ {
+        shard := command
+        shard.NumShards = shards
+        shard.ShardIndex = i
+        commands = append(commands, shard)
+    }
+    return commands, nil
+}
+
+// targetVariables returns the variables of running the command against the outputs.
+func targetVariables(command instrument.Command, outputs gradle.Outputs) ([]Variable, error) {
+    commandJSON, err := command.JSON()
+    if err != nil {
+        return nil, err
+    }
 
+    // The quotes around ADB_COMMAND are kept for the workflows which strip them.
+    variables := []Variable{
+        {Key: "ADB_COMMAND", Value: fmt.Sprintf("\"%s\"", command)},
+        {Key: "ADB_COMMAND_JSON", Value: commandJSON},
+    }
+    // The APKs are passed by name, the deploy directory of this build doesn't exist on the triggered builds' machines.
+    if outputs.TargetAPK != "" {
+        variables = append(variables, Variable{Key: "TARGET_APK", Value: filepath.Base(outputs.TargetAPK)})
+    }
+    if outputs.AppAPK != "" {
+        variables = append(variables, Variable{Key: "APP_APK", Value: filepath.Base(outputs.AppAPK)})
+    }
+    if outputs.TestAPK != "" {
+        variables = append(variables, Variable{Key: "TEST_APK", Value: filepath.Base(outputs.TestAPK)})
+    }
+    return variables, nil
+}
+
+// TargetEnvs returns the environment variables of every shard the module's tests are split into, a single set without test_shards.
+// The test package and runner are read from the test APK unless set by the inputs.
+// The APK variables are only set for the APKs present in outputs, the shard variables only if there are several shards.
+func TargetEnvs(outputs gradle.Outputs) ([][]Variable, error) {
+    info, found := findTestAPK(outputs)
+    return targetEnvs(outputs, info, found, false)
+}
+
+// PlanTargetEnvs returns the environment TargetEnvs returns once the APKs found in the module's build outputs are deployed to outputs.
+// Without a test APK built yet, the test package and runner not set by the inputs are planned as a placeholder.
+func PlanTargetEnvs(found, outputs gradle.Outputs) ([][]Variable, error) {
+    info, ok := findTestAPK(found)
+    return targetEnvs(outputs, info, ok, !ok)
+}
+
+func targetEnvs(outputs gradle.Outputs, info androidartifact.TestApkInfo, found, placeholder bool) ([][]Variable, error) {
     var cfg TargetConfig
     if err := stepconf.Parse(&cfg); err != nil {
-        util.Failf("Issue with an input: %s", err)
+        return nil, util.ConfigErrorf("Issue with an input: %s", err)
+    }
+    if placeholder {
+        if cfg.TestPackage == "" {
+            cfg.TestPackage = testAPKPlaceholder
+        }
+        if cfg.TestRunner == "" {
+            cfg.TestRunner = testAPKPlaceholder
+        }
+    }
+    cfg, err := resolveTestTarget(cfg, info, found)
+    if err != nil {
+        return nil, util.ConfigErrorf("Issue with an input: %s", err)
     }
 
-    var runnerBuilder string
-    if cfg.JUnit5 {
-        runnerBuilder = "-e runnerBuilder de.mannodermaus.junit5.AndroidJUnit5Builder"
-    } else {
-        runnerBuilder = ""
+    command, err := instrumentCommand(cfg)
+    if err != nil {
+        return nil, util.ConfigErrorf("Issue with an input: %s", err)
+    }
+    commands, err := shardCommands(command, cfg.Shards)
+    if err != nil {
+        return nil, util.ConfigErrorf("Issue with an input: %s", err)
     }
 
-    adbFormatString := "\"adb shell am instrument -r -w %s %s/%s\""
-    adbCommand := fmt.Sprintf(adbFormatString, runnerBuilder, cfg.TestPackage, cfg.TestRunner)
-    log.Infof("Set adb command to [%s]", adbCommand)
-    execmd.ExecuteCommand("envman", "add", "--key", "ADB_COMMAND", "--value", adbCommand)
-    os.Setenv("ADB_COMMAND", adbCommand)
+    var sets [][]Variable
+    for i, command := range commands {
+        variables, err := targetVariables(command, outputs)
+        if err != nil {
+            return nil, err
+        }
+        if len(commands) > 1 {
+            variables = append(variables,
+                Variable{Key: "SHARD_INDEX", Value: strconv.Itoa(i)},
+                Variable{Key: "NUM_SHARDS", Value: strconv.Itoa(len(commands))},
+            )
+        }
+        sets = append(sets, variables)
+    }
+    return sets, nil
+}
 
-    log.Infof("Set target apk to [%s]", cfg.APK)
-    execmd.ExecuteCommand("envman", "add", "--key", "TARGET_APK", "--value", cfg.APK)
-    os.Setenv("TARGET_APK", cfg.APK)
+// Values returns the values of the variables to pass to the triggered workflows, with the module's name.
+func Values(module string, variables []Variable) map[string]string {
+    values := map[string]string{"MODULE_NAME": module}
+    for _, variable := range variables {
+        values[variable.Key] = variable.Value
+    }
+    return values
+}
+
+// ShardName names the shard of the module's tests, the module itself if they are not split.
+func ShardName(module string, index, count int) string {
+    if count < 2 {
+        return module
+    }
+    return fmt.Sprintf("%s shard %d/%d", module, index + 1, count)
+}
 
-    os.Setenv("MODULE_NAME", cfg.Module)
+// SetTargetEnv exports the environment of the module and returns the environment of each of its shards.
+// With several shards the exported values are the first shard's.
+func SetTargetEnv(module string, outputs gradle.Outputs) ([][]Variable, error) {
+    log.Infof("=== Set target environment of %s ===", module)
+
+    sets, err := TargetEnvs(outputs)
+    if err != nil {
+        return nil, err
+    }
+    if len(sets) > 1 {
+        log.Infof("Tests split into %d shards", len(sets))
+    }
+    for _, variable := range sets[0] {
+        log.Infof("Set %s to [%s]", variable.Key, variable.Value)
+        if err := execmd.ExportEnv(variable.Key, variable.Value); err != nil {
+            return nil, err
+        }
+    }
+
+    if err := os.Setenv("MODULE_NAME", module); err != nil {
+        return nil, err
+    }
+    return sets, nil
 }
@@ -0,0 +1,86 @@
+package env
+
+import (
+    "fmt"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/androidartifact"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gradle"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/instrument"
+    "testing"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestResolveTestTarget(t *testing.T) {
+    info := androidartifact.TestApkInfo{
+        PackageName:      "com.example.login.test",
+        Instrumentations: []androidartifact.Instrumentation{{Name: "com.example.HiltTestRunner", TargetPackage: "com.example.login"}},
+    }
+
+    cfg, err := resolveTestTarget(TargetConfig{}, info, true)
+    require.NoError(t, err)
+    require.Equal(t, "com.example.login.test", cfg.TestPackage)
+    require.Equal(t, "com.example.HiltTestRunner", cfg.TestRunner)
+    require.False(t, cfg.JUnit5)
+
+    cfg, err = resolveTestTarget(TargetConfig{TestPackage: "com.example.other.test", TestRunner: "com.example.Runner"}, info, true)
+    require.NoError(t, err)
+    require.Equal(t, "com.example.other.test", cfg.TestPackage)
+    require.Equal(t, "com.example.Runner", cfg.TestRunner)
+
+    info.JUnit5 = true
+    cfg, err = resolveTestTarget(TargetConfig{}, info, true)
+    require.NoError(t, err)
+    require.True(t, cfg.JUnit5)
+
+    cfg, err = resolveTestTarget(TargetConfig{TestPackage: "com.example.login.test", JUnit5: true}, androidartifact.TestApkInfo{}, false)
+    require.NoError(t, err)
+    require.True(t, cfg.JUnit5)
+
+    cfg, err = resolveTestTarget(TargetConfig{TestPackage: "com.example.login.test"}, androidartifact.TestApkInfo{}, false)
+    require.NoError(t, err)
+    require.Equal(t, defaultTestRunner, cfg.TestRunner)
+
+    _, err = resolveTestTarget(TargetConfig{}, androidartifact.TestApkInfo{}, false)
+    require.Error(t, err)
+}
+
+func TestShardCommands(t *testing.T) {
+    command := instrument.Command{TestPackage: "com.example.login.test", Runner: "androidx.test.runner.AndroidJUnitRunner"}
+
+    commands, err := shardCommands(command, 0)
+    require.NoError(t, err)
+    require.Equal(t, []instrument.Command{command}, commands)
+
+    commands, err = shardCommands(command, 3)
+    require.NoError(t, err)
+    require.Len(t, commands, 3)
+    for i, shard := range commands {
+        require.Equal(t, 3, shard.NumShards)
+        require.Equal(t, i, shard.ShardIndex)
+        require.Contains(t, shard.String(), fmt.Sprintf("-e numShards 3 -e shardIndex %d", i))
+    }
+
+    _, err = shardCommands(instrument.Command{NumShards: 2}, 3)
+    require.Error(t, err)
+    _, err = shardCommands(command, -1)
+    require.Error(t, err)
+}
+
+func TestShardName(t *testing.T) {
+    require.Equal(t, "feature-login", ShardName("feature-login", 0, 1))
+    require.Equal(t, "feature-login shard 2/4", ShardName("feature-login", 1, 4))
+}
+
+func TestTargetVariables(t *testing.T) {
+    variables, err := targetVariables(instrument.Command{TestPackage: "com.example.test", Runner: "Runner"}, gradle.Outputs{
+        AppAPK:    "/deploy/app-debug.apk",
+        TestAPK:   "/deploy/app-debug-androidTest.apk",
+        TargetAPK: "/deploy/app-debug-androidTest.apk",
+    })
+    require.NoError(t, err)
+    require.Equal(t, []Variable{
+        {Key: "TARGET_APK", Value: "app-debug-androidTest.apk"},
+        {Key: "APP_APK", Value: "app-debug.apk"},
+        {Key: "TEST_APK", Value: "app-debug-androidTest.apk"},
+    }, variables[2:])
+}
@@ -1,62 +1,34 @@
 package execmd
 
 import (
+    "context"
     "fmt"
-    // "path/filepath"
     "os"
-    "os/exec"
     "github.com/bitrise-io/go-utils/log"
-    "github.com/bitrise-steplib/bitrise-step-build-router-start/util"
 )
 
-func ExecuteRelativeCommand(executablePath string, a ...string) {
-    args := append([]string {executablePath}, a...)
-    log.Infof("Executing %s", args)
-    cmd := &exec.Cmd {
-        Path: executablePath,
-        Args: args,
-        Stdout: os.Stdout,
-        Stderr: os.Stdout,
-    }
-
-    if err := cmd.Run(); err != nil {
-        util.Failf("Error %s", err)
+func ExecuteRelativeCommand(executablePath string, a ...string) error {
+    if _, err := (Runner{Stream: true}).Run(context.Background(), executablePath, a...); err != nil {
+        return err
     }
     log.Infof("OK")
+    return nil
 }
 
-func ExecuteCommand(executable string, a ...string) {
-    executablePath, _ := exec.LookPath( executable )
-    ExecuteRelativeCommand(executablePath, a...)
+func ExecuteCommand(executable string, a ...string) error {
+    return ExecuteRelativeCommand(executable, a...)
 }
 
-func ExecuteShellScript(script string) string {
-
-    // dir, err := os.Getwd()
-    // if err != nil {
-    //     fmt.Println(err)
-    // }
-
+func ExecuteShellScript(script string) (string, error) {
     dir := os.Getenv("BITRISE_SOURCE_DIR")
-
     log.Infof(dir)
 
-    // dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
-    // if err != nil {
-    //     util.Failf("Error %s", err)
-    // }
-
-    // dir := os.Args[0]
-    // fmt.Println(dir)
-
     scriptPath := fmt.Sprintf("%s/%s", dir, script)
-    log.Infof("Executing script %s", scriptPath)
-    cmd, err := exec.Command("/bin/sh", scriptPath).Output()
+    result, err := Runner{}.Run(context.Background(), "/bin/sh", scriptPath)
     if err != nil {
-        util.Failf("Error %s", err)
+        return "", err
     }
 
-    output := string(cmd)
     log.Infof("OK")
-    return output
+    return result.Stdout, nil
 }
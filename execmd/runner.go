@@ -0,0 +1,110 @@
+package execmd
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "os/exec"
+    "strings"
+    "time"
+    "github.com/bitrise-io/go-utils/log"
+)
+
+// Runner runs commands and reports their outcome instead of exiting the process.
+type Runner struct {
+    // Dir is the working directory, the current one if empty.
+    Dir         string
+    // Env overrides the inherited environment with `KEY=value` entries.
+    Env         []string
+    // Timeout cancels the command once elapsed, no timeout if zero.
+    Timeout     time.Duration
+    // Stream echoes stdout and stderr to the log while capturing them.
+    Stream      bool
+}
+
+// Result is the outcome of a command.
+type Result struct {
+    Command     string
+    ExitCode    int
+    Stdout      string
+    Stderr      string
+    Duration    time.Duration
+}
+
+// ExitError is returned when the command ran but did not succeed.
+type ExitError struct {
+    Result      Result
+    TimedOut    bool
+}
+
+func (e *ExitError) Error() string {
+    if e.TimedOut {
+        return fmt.Sprintf("%s timed out after %s", e.Result.Command, e.Result.Duration)
+    }
+    return fmt.Sprintf("%s exited with %d: %s", e.Result.Command, e.Result.ExitCode, strings.TrimSpace(e.Result.Stderr))
+}
+
+// Run runs the command until it exits, the context is done or the timeout elapses.
+func (r Runner) Run(ctx context.Context, name string, args ...string) (Result, error) {
+    if r.Timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+        defer cancel()
+    }
+
+    result := Result{Command: strings.Join(append([]string{name}, args...), " ")}
+
+    cmd := exec.CommandContext(ctx, name, args...)
+    cmd.Dir = r.Dir
+    if len(r.Env) > 0 {
+        cmd.Env = append(os.Environ(), r.Env...)
+    }
+
+    var stdout, stderr bytes.Buffer
+    cmd.Stdout, cmd.Stderr = &stdout, &stderr
+    if r.Stream {
+        cmd.Stdout = io.MultiWriter(&stdout, os.Stdout)
+        cmd.Stderr = io.MultiWriter(&stderr, os.Stdout)
+    }
+
+    log.Infof("Executing %s", result.Command)
+    start := time.Now()
+    err := cmd.Run()
+    result.Duration = time.Since(start)
+    result.Stdout = stdout.String()
+    result.Stderr = stderr.String()
+
+    if err == nil {
+        return result, nil
+    }
+
+    var exitErr *exec.ExitError
+    if errors.As(err, &exitErr) {
+        result.ExitCode = exitErr.ExitCode()
+        return result, &ExitError{Result: result, TimedOut: ctx.Err() == context.DeadlineExceeded}
+    }
+    result.ExitCode = -1
+    if ctx.Err() != nil {
+        return result, &ExitError{Result: result, TimedOut: ctx.Err() == context.DeadlineExceeded}
+    }
+    return result, fmt.Errorf("failed to run %s: %s", result.Command, err)
+}
+
+// UseEnvman is whether ExportEnv exports with envman. Disabled when running outside of a Bitrise build,
+// where the exported values are printed instead.
+var UseEnvman = true
+
+// ExportEnv exports an environment variable to the following steps with envman, and to this process.
+func ExportEnv(key, value string) error {
+    if !UseEnvman {
+        log.Printf("%s=%s", key, value)
+        return os.Setenv(key, value)
+    }
+    if _, err := (Runner{}).Run(context.Background(), "envman", "add", "--key", key, "--value", value); err != nil {
+        return fmt.Errorf("failed to export %s: %s", key, err)
+    }
+    return os.Setenv(key, value)
+}
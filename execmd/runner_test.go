@@ -0,0 +1,42 @@
+package execmd
+
+import (
+    "context"
+    "errors"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestRunner_Run(t *testing.T) {
+    dir, err := ioutil.TempDir("", "runner")
+    require.NoError(t, err)
+    defer os.RemoveAll(dir)
+    dir, err = filepath.EvalSymlinks(dir)
+    require.NoError(t, err)
+
+    result, err := Runner{Dir: dir, Env: []string{"GREETING=hello"}}.Run(context.Background(), "sh", "-c", `echo "$GREETING from $(pwd)"; echo oops >&2`)
+    require.NoError(t, err)
+    require.Equal(t, 0, result.ExitCode)
+    require.Equal(t, "hello from "+dir+"\n", result.Stdout)
+    require.Equal(t, "oops\n", result.Stderr)
+
+    result, err = Runner{}.Run(context.Background(), "sh", "-c", "echo failed >&2; exit 3")
+    var exitErr *ExitError
+    require.True(t, errors.As(err, &exitErr))
+    require.False(t, exitErr.TimedOut)
+    require.Equal(t, 3, result.ExitCode)
+    require.Equal(t, "sh -c echo failed >&2; exit 3 exited with 3: failed", err.Error())
+
+    result, err = Runner{Timeout: 50 * time.Millisecond}.Run(context.Background(), "sleep", "5")
+    require.True(t, errors.As(err, &exitErr))
+    require.True(t, exitErr.TimedOut)
+    require.True(t, result.Duration < 5*time.Second)
+
+    _, err = Runner{}.Run(context.Background(), "this-command-does-not-exist")
+    require.Error(t, err)
+}
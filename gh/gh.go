@@ -4,73 +4,153 @@ import (
     "context"
     "fmt"
     "github.com/bitrise-io/go-steputils/stepconf"
-    "github.com/bitrise-steplib/bitrise-step-build-router-start/util"
+    "github.com/bitrise-io/go-utils/log"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/diff"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gitdiff"
     "github.com/google/go-github/github"
     "golang.org/x/oauth2"
-    "math"
-    "os"
+    "net/http"
     "strconv"
-    "strings"
 )
 
-const owner = "neofinancial"
-const repo = "neo-android"
-
 type GitHubConfig struct {
-    Token    string    `env:"github_access_token,required"`
+    Token          string    `env:"github_access_token,required"`
+    Owner          string    `env:"github_repo_owner,required"`
+    Repo           string    `env:"github_repo_name,required"`
+    BaseURL        string    `env:"git_api_base_url"`
+    PullRequest    string    `env:"PULL_REQUEST_ID"`
 }
 
-func getNumPages(numChangedFiles int) int {
-    return int(math.Ceil(float64(numChangedFiles) / 30.0))
-}
+const (
+    filesPerPage = 100
+    // maxListedFiles is the most files the pull request files endpoint lists, the others are silently dropped.
+    // The compare API is no alternative, it lists even fewer (300).
+    maxListedFiles = 3000
+)
 
-func getModuleName(filename string) string {
-    const feature_dir_prefix = "features/"
-    var path string
-    if strings.HasPrefix(filename, feature_dir_prefix) {
-        path = "feature-" + strings.TrimPrefix(filename, feature_dir_prefix)
-    } else {
-        path = filename
-    }
-    return strings.Split(path, "/")[0]
+// ChangeSource lists the files changed by the pull request under test using the GitHub API.
+type ChangeSource struct {
+    cfg GitHubConfig
 }
 
-func GetChangedModules() map[string]bool {
+func NewChangeSource() (*ChangeSource, error) {
     var cfg GitHubConfig
     if err := stepconf.Parse(&cfg); err != nil {
-        util.Failf("Issue with an input: %s", err)
+        return nil, err
     }
+    return &ChangeSource{cfg: cfg}, nil
+}
 
-    modulesChanged := map[string]bool{}
-    if cfg.Token == "testing" {
-        return modulesChanged
+// newClient returns a client of api.github.com, or of the GitHub Enterprise API at baseURL, e.g. `https://github.example.com/api/v3/`.
+func newClient(ctx context.Context, token, baseURL string) (*github.Client, error) {
+    ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+    httpClient := oauth2.NewClient(ctx, ts)
+    if baseURL == "" {
+        return github.NewClient(httpClient), nil
     }
+    client, err := github.NewEnterpriseClient(baseURL, baseURL, httpClient)
+    if err != nil {
+        return nil, fmt.Errorf("invalid git_api_base_url (%s): %s", baseURL, err)
+    }
+    return client, nil
+}
 
-    ctx := context.Background()
-    ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: cfg.Token})
-    tc := oauth2.NewClient(ctx, ts)
-    client := github.NewClient(tc)
-
-    prNumber, _ := strconv.Atoi(os.Getenv("PULL_REQUEST_ID"))
-    pr, _, _ := client.PullRequests.Get(ctx, owner, repo, prNumber)
+// apiError explains the failed request, with a hint at the input to check for the usual causes.
+func apiError(action string, err error) error {
+    switch e := err.(type) {
+    case *github.RateLimitError:
+        return fmt.Errorf("failed to %s: GitHub API rate limit exceeded, it resets at %s", action, e.Rate.Reset.Time)
+    case *github.ErrorResponse:
+        if e.Response != nil {
+            switch e.Response.StatusCode {
+            case http.StatusUnauthorized:
+                return fmt.Errorf("failed to %s: %s, check github_access_token", action, e.Message)
+            case http.StatusNotFound:
+                return fmt.Errorf("failed to %s: not found, check github_repo_owner, github_repo_name and that github_access_token can access the repository", action)
+            }
+        }
+    }
+    return fmt.Errorf("failed to %s: %s", action, err)
+}
 
-    numPages := getNumPages(*pr.ChangedFiles)
+// pullRequestFile is an entry of the pull request files endpoint.
+// The vendored go-github CommitFile lacks previous_filename, hence the own type.
+type pullRequestFile struct {
+    Filename            string    `json:"filename"`
+    PreviousFilename    string    `json:"previous_filename"`
+    Status              string    `json:"status"`
+}
 
-    for i := 1; i <= numPages; i++ {
-        fmt.Println("Fetching page", i, "...")
-        opts := &github.ListOptions{Page: i}
-        files, _, _ := client.PullRequests.ListFiles(ctx, owner, repo, prNumber, opts)
+// listFiles returns the files of the pull request, following the pages of the Link header.
+func listFiles(ctx context.Context, client *github.Client, owner, repo string, number int) ([]diff.File, error) {
+    var changedFiles []diff.File
+    page := 1
+    for {
+        log.Printf("Fetching page %d ...", page)
+        u := fmt.Sprintf("repos/%v/%v/pulls/%d/files?page=%d&per_page=%d", owner, repo, number, page, filesPerPage)
+        req, err := client.NewRequest("GET", u, nil)
+        if err != nil {
+            return nil, err
+        }
 
-        for _, s := range files {
-           filename := getModuleName(*s.Filename)
-            modulesChanged[filename] = true
+        var files []pullRequestFile
+        resp, err := client.Do(ctx, req, &files)
+        if err != nil {
+            return nil, apiError(fmt.Sprintf("list the files of pull request #%d", number), err)
+        }
+        for _, f := range files {
+            file := diff.File{Path: f.Filename, Status: diff.ParseGitStatus(f.Status)}
+            if file.Status == diff.Renamed {
+                file.PreviousPath = f.PreviousFilename
+            }
+            changedFiles = append(changedFiles, file)
         }
+        if resp.NextPage == 0 {
+            return changedFiles, nil
+        }
+        page = resp.NextPage
+    }
+}
+
+func (s *ChangeSource) ChangedFiles() ([]diff.File, error) {
+    var changedFiles []diff.File
+    if s.cfg.Token == "testing" {
+        return changedFiles, nil
     }
 
-    fmt.Println("Changes detected in:")
-    for key, _ := range modulesChanged {
-        fmt.Println(" - [", key, "]")
+    if s.cfg.PullRequest == "" {
+        return nil, fmt.Errorf("PULL_REQUEST_ID is not set, the github change source only works in pull request builds, use the git change source otherwise")
+    }
+    number, err := strconv.Atoi(s.cfg.PullRequest)
+    if err != nil {
+        return nil, fmt.Errorf("invalid PULL_REQUEST_ID (%s): %s", s.cfg.PullRequest, err)
+    }
+
+    ctx := context.Background()
+    client, err := newClient(ctx, s.cfg.Token, s.cfg.BaseURL)
+    if err != nil {
+        return nil, err
     }
 
-    return modulesChanged
+    pr, _, err := client.PullRequests.Get(ctx, s.cfg.Owner, s.cfg.Repo, number)
+    if err != nil {
+        return nil, apiError(fmt.Sprintf("get pull request #%d of %s/%s", number, s.cfg.Owner, s.cfg.Repo), err)
+    }
+
+    if pr.GetChangedFiles() > maxListedFiles {
+        log.Warnf("Pull request #%d changes %d files, the GitHub API lists at most %d, diffing with git instead", number, pr.GetChangedFiles(), maxListedFiles)
+        source, err := gitdiff.NewChangeSourceForBranch(pr.GetBase().GetRef())
+        if err != nil {
+            return nil, err
+        }
+        return source.ChangedFiles()
+    }
+
+    if changedFiles, err = listFiles(ctx, client, s.cfg.Owner, s.cfg.Repo, number); err != nil {
+        return nil, err
+    }
+    if len(changedFiles) != pr.GetChangedFiles() {
+        log.Warnf("Pull request #%d changes %d files, %d were listed, was it updated meanwhile?", number, pr.GetChangedFiles(), len(changedFiles))
+    }
+    return changedFiles, nil
 }
@@ -0,0 +1,77 @@
+package gh
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "testing"
+
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/diff"
+    "github.com/google/go-github/github"
+    "github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *github.Client {
+    server := httptest.NewServer(handler)
+    t.Cleanup(server.Close)
+
+    client := github.NewClient(nil)
+    baseURL, err := url.Parse(server.URL + "/")
+    require.NoError(t, err)
+    client.BaseURL = baseURL
+    return client
+}
+
+func TestListFiles(t *testing.T) {
+    const total = 250
+    client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+        require.Equal(t, "/repos/owner/repo/pulls/7/files", r.URL.Path)
+        require.Equal(t, "100", r.URL.Query().Get("per_page"))
+
+        page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+        if page == 0 {
+            page = 1
+        }
+        if page * filesPerPage < total {
+            w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d&per_page=100>; rel="next"`, r.URL.Path, page + 1))
+        }
+
+        fmt.Fprint(w, "[")
+        for i := (page - 1) * filesPerPage; i < page * filesPerPage && i < total; i++ {
+            if i % filesPerPage != 0 {
+                fmt.Fprint(w, ",")
+            }
+            if i == 0 {
+                fmt.Fprint(w, `{"filename":"features/b/Moved.kt","previous_filename":"features/a/Moved.kt","status":"renamed"}`)
+                continue
+            }
+            fmt.Fprintf(w, `{"filename":"file%d","status":"modified"}`, i)
+        }
+        fmt.Fprint(w, "]")
+    })
+
+    files, err := listFiles(context.Background(), client, "owner", "repo", 7)
+    require.NoError(t, err)
+    require.Len(t, files, total)
+    require.Equal(t, diff.File{Path: "features/b/Moved.kt", PreviousPath: "features/a/Moved.kt", Status: diff.Renamed}, files[0])
+    require.Equal(t, diff.File{Path: "file249", Status: diff.Modified}, files[total - 1])
+}
+
+func TestListFiles_Errors(t *testing.T) {
+    for status, message := range map[int]string{
+        http.StatusUnauthorized: "failed to list the files of pull request #7: Bad credentials, check github_access_token",
+        http.StatusNotFound:     "failed to list the files of pull request #7: not found, check github_repo_owner, github_repo_name and that github_access_token can access the repository",
+    } {
+        status := status
+        client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+            w.WriteHeader(status)
+            fmt.Fprint(w, `{"message":"Bad credentials"}`)
+        })
+
+        _, err := listFiles(context.Background(), client, "owner", "repo", 7)
+        require.EqualError(t, err, message)
+    }
+}
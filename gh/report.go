@@ -0,0 +1,227 @@
+package gh
+
+import (
+    "context"
+    "fmt"
+    "github.com/bitrise-io/go-steputils/stepconf"
+    "github.com/bitrise-io/go-utils/log"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/trigger"
+    "github.com/google/go-github/github"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+type ReportConfig struct {
+    Mode            string    `env:"pr_report,opt[none,status,comment]"`
+    Commit          string    `env:"BITRISE_GIT_COMMIT"`
+    BuildURL        string    `env:"BITRISE_BUILD_URL"`
+    Environments    string    `env:"environment_key_list"`
+}
+
+// Outcomes of a module.
+const (
+    // OutcomeTested is a module whose test workflows were started, but not waited for.
+    OutcomeTested  = "tested"
+    OutcomePassed  = "passed"
+    OutcomeSkipped = "skipped"
+    OutcomeFailed  = "failed"
+)
+
+// The status of a module, passed to its test workflows to update it.
+const (
+    EnvStatusContext = "MODULE_STATUS_CONTEXT"
+    EnvStatusCommit  = "MODULE_STATUS_COMMIT"
+)
+
+// ModuleReport is what the step did with a module, and why.
+type ModuleReport struct {
+    Module     string
+    Outcome    string
+    Reason     string
+}
+
+const (
+    statusContextPrefix = "module-tests/"
+    // commentMarkerFormat identifies the comment of a step by its modules,
+    // which is updated instead of adding a new one on every build.
+    commentMarkerFormat = "<!-- build-module-report: %s -->"
+)
+
+// statusState returns the commit status of a module: tested modules are pending
+// as their test workflows are only started, passed and skipped modules have nothing left to run.
+func statusState(outcome string) string {
+    switch outcome {
+    case OutcomeFailed:
+        return "failure"
+    case OutcomeTested:
+        return "pending"
+    }
+    return "success"
+}
+
+// StatusContext returns the context of the module's commit status.
+func StatusContext(module string) string {
+    return statusContextPrefix + module
+}
+
+// StatusEnv returns the variables telling the module's test workflows which commit status to update.
+func StatusEnv(module string) map[string]string {
+    return map[string]string{
+        EnvStatusContext: StatusContext(module),
+        EnvStatusCommit:  os.Getenv("BITRISE_GIT_COMMIT"),
+    }
+}
+
+// TestReport returns the outcome of a module by the results of its test builds, across its shards.
+// The module is only tested if its builds were not waited for.
+func TestReport(module string, results []trigger.Result) ModuleReport {
+    finished, unsuccessful, total := trigger.ModuleOutcome(results, module)
+    switch {
+    case !finished:
+        return ModuleReport{Module: module, Outcome: OutcomeTested, Reason: "test workflows started"}
+    case unsuccessful > 0:
+        return ModuleReport{Module: module, Outcome: OutcomeFailed, Reason: fmt.Sprintf("%d of %d test builds did not succeed", unsuccessful, total)}
+    }
+    return ModuleReport{Module: module, Outcome: OutcomePassed, Reason: fmt.Sprintf("%d/%d test builds succeeded", total, total)}
+}
+
+// sharesKey returns true if the key is in the environment_key_list.
+func sharesKey(environmentKeys, key string) bool {
+    for _, shared := range strings.Split(strings.Replace(environmentKeys, "$", "", -1), "\n") {
+        if strings.TrimSpace(shared) == key {
+            return true
+        }
+    }
+    return false
+}
+
+// resolvableStatuses leaves out the pending statuses of the tested modules if their test workflows can't update them,
+// i.e. the status context is not shared with them.
+func resolvableStatuses(reports []ModuleReport, environmentKeys string) []ModuleReport {
+    if sharesKey(environmentKeys, EnvStatusContext) {
+        return reports
+    }
+    var resolvable []ModuleReport
+    for _, report := range reports {
+        if report.Outcome == OutcomeTested {
+            log.Infof("Not setting a pending status for %s, enable wait_for_builds or share %s with the test workflows", report.Module, EnvStatusContext)
+            continue
+        }
+        resolvable = append(resolvable, report)
+    }
+    return resolvable
+}
+
+func commentBody(reports []ModuleReport, buildURL string) string {
+    var b strings.Builder
+    b.WriteString(commentMarker(reports) + "\n### Module tests\n\n| Module | Outcome | Reason |\n| --- | --- | --- |\n")
+    for _, report := range reports {
+        fmt.Fprintf(&b, "| `%s` | %s | %s |\n", report.Module, report.Outcome, report.Reason)
+    }
+    if buildURL != "" {
+        fmt.Fprintf(&b, "\n[Bitrise build](%s)\n", buildURL)
+    }
+    return b.String()
+}
+
+// commentMarker returns the marker of the comment reporting the modules.
+// Steps reporting different modules, e.g. one step per module running in parallel, never update the same comment,
+// as GitHub can't update a comment only if it wasn't changed since it was read.
+func commentMarker(reports []ModuleReport) string {
+    var names []string
+    for _, report := range reports {
+        names = append(names, report.Module)
+    }
+    sort.Strings(names)
+    return fmt.Sprintf(commentMarkerFormat, strings.Join(names, ","))
+}
+
+func postStatuses(ctx context.Context, client *github.Client, cfg GitHubConfig, commit, buildURL string, reports []ModuleReport) error {
+    if commit == "" {
+        return fmt.Errorf("BITRISE_GIT_COMMIT is not set, no commit to set the status of")
+    }
+    for _, report := range reports {
+        status := &github.RepoStatus{
+            State:       github.String(statusState(report.Outcome)),
+            Description: github.String(fmt.Sprintf("%s – %s", report.Outcome, report.Reason)),
+            Context:     github.String(StatusContext(report.Module)),
+        }
+        if buildURL != "" {
+            status.TargetURL = github.String(buildURL)
+        }
+        if _, _, err := client.Repositories.CreateStatus(ctx, cfg.Owner, cfg.Repo, commit, status); err != nil {
+            return apiError(fmt.Sprintf("set the status of %s", report.Module), err)
+        }
+    }
+    return nil
+}
+
+// postComment updates the comment of the step on the pull request with the reports, or adds it if there is none yet.
+func postComment(ctx context.Context, client *github.Client, cfg GitHubConfig, number int, reports []ModuleReport, buildURL string) error {
+    body := commentBody(reports, buildURL)
+    marker := commentMarker(reports) + "\n"
+    opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{Page: 1, PerPage: filesPerPage}}
+    for {
+        comments, resp, err := client.Issues.ListComments(ctx, cfg.Owner, cfg.Repo, number, opts)
+        if err != nil {
+            return apiError(fmt.Sprintf("list the comments of pull request #%d", number), err)
+        }
+        for _, comment := range comments {
+            if strings.HasPrefix(comment.GetBody(), marker) {
+                if _, _, err := client.Issues.EditComment(ctx, cfg.Owner, cfg.Repo, comment.GetID(), &github.IssueComment{Body: github.String(body)}); err != nil {
+                    return apiError(fmt.Sprintf("update the comment of pull request #%d", number), err)
+                }
+                return nil
+            }
+        }
+        if resp.NextPage == 0 {
+            break
+        }
+        opts.Page = resp.NextPage
+    }
+
+    if _, _, err := client.Issues.CreateComment(ctx, cfg.Owner, cfg.Repo, number, &github.IssueComment{Body: github.String(body)}); err != nil {
+        return apiError(fmt.Sprintf("comment on pull request #%d", number), err)
+    }
+    return nil
+}
+
+// Report posts the outcome of the modules to the pull request, as commit statuses or as a comment, depending on pr_report.
+func Report(reports []ModuleReport) error {
+    var reportCfg ReportConfig
+    if err := stepconf.Parse(&reportCfg); err != nil {
+        return err
+    }
+    if reportCfg.Mode == "" || reportCfg.Mode == "none" || len(reports) == 0 {
+        return nil
+    }
+
+    var cfg GitHubConfig
+    if err := stepconf.Parse(&cfg); err != nil {
+        return err
+    }
+    if cfg.Token == "testing" {
+        return nil
+    }
+
+    ctx := context.Background()
+    client, err := newClient(ctx, cfg.Token, cfg.BaseURL)
+    if err != nil {
+        return err
+    }
+
+    if reportCfg.Mode == "status" {
+        reports = resolvableStatuses(reports, reportCfg.Environments)
+        log.Infof("Setting the status of %d modules on %s", len(reports), reportCfg.Commit)
+        return postStatuses(ctx, client, cfg, reportCfg.Commit, reportCfg.BuildURL, reports)
+    }
+
+    number, err := strconv.Atoi(cfg.PullRequest)
+    if err != nil {
+        return fmt.Errorf("no pull request to comment on, PULL_REQUEST_ID: %s", cfg.PullRequest)
+    }
+    log.Infof("Commenting on pull request #%d", number)
+    return postComment(ctx, client, cfg, number, reports, reportCfg.BuildURL)
+}
@@ -0,0 +1,133 @@
+package gh
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "testing"
+
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/trigger"
+    "github.com/stretchr/testify/require"
+)
+
+var testReports = []ModuleReport{
+    {Module: "feature-login", Outcome: OutcomeTested, Reason: "test workflows started"},
+    {Module: "feature-cards", Outcome: OutcomeSkipped, Reason: "no changes"},
+}
+
+func TestCommentBody(t *testing.T) {
+    require.Equal(t, `<!-- build-module-report: feature-cards,feature-login -->
+### Module tests
+
+| Module | Outcome | Reason |
+| --- | --- | --- |
+| `+"`feature-login`"+` | tested | test workflows started |
+| `+"`feature-cards`"+` | skipped | no changes |
+
+[Bitrise build](https://app.bitrise.io/build/1)
+`, commentBody(testReports, "https://app.bitrise.io/build/1"))
+}
+
+func TestStatusState(t *testing.T) {
+    require.Equal(t, "pending", statusState(OutcomeTested))
+    require.Equal(t, "success", statusState(OutcomePassed))
+    require.Equal(t, "success", statusState(OutcomeSkipped))
+    require.Equal(t, "failure", statusState(OutcomeFailed))
+}
+
+func TestCommentMarker(t *testing.T) {
+    require.Equal(t, "<!-- build-module-report: feature-cards,feature-login -->", commentMarker(testReports))
+    require.Equal(t, "<!-- build-module-report: feature-login -->", commentMarker(testReports[:1]))
+}
+
+func TestTestReport(t *testing.T) {
+    // Waited for: the shards of feature-login, and the single build of feature-cards.
+    results := []trigger.Result{
+        {Group: "feature-login shard 1/2", Module: "feature-login", Workflow: "test", Status: "successful"},
+        {Group: "feature-login shard 2/2", Module: "feature-login", Workflow: "test", Status: "failed"},
+        {Group: "feature-cards", Module: "feature-cards", Workflow: "test", Status: "successful"},
+    }
+    require.Equal(t, ModuleReport{Module: "feature-login", Outcome: OutcomeFailed, Reason: "1 of 2 test builds did not succeed"}, TestReport("feature-login", results))
+    require.Equal(t, ModuleReport{Module: "feature-cards", Outcome: OutcomePassed, Reason: "1/1 test builds succeeded"}, TestReport("feature-cards", results))
+    require.Equal(t, "failure", statusState(TestReport("feature-login", results).Outcome))
+    require.Equal(t, "success", statusState(TestReport("feature-cards", results).Outcome))
+
+    // Not waited for.
+    running := []trigger.Result{{Group: "feature-login", Module: "feature-login", Workflow: "test", Status: "running"}}
+    require.Equal(t, ModuleReport{Module: "feature-login", Outcome: OutcomeTested, Reason: "test workflows started"}, TestReport("feature-login", running))
+    require.Equal(t, OutcomeTested, TestReport("feature-login", nil).Outcome)
+}
+
+func TestResolvableStatuses(t *testing.T) {
+    require.Equal(t, testReports, resolvableStatuses(testReports, "$ADB_COMMAND\n$MODULE_STATUS_CONTEXT\n"))
+    require.Equal(t, testReports[1:], resolvableStatuses(testReports, "$ADB_COMMAND"))
+}
+
+func TestPostComment(t *testing.T) {
+    // Another step's comment, reporting feature-login only, and the one of this step from a previous build.
+    otherStep := commentBody(testReports[:1], "https://app.bitrise.io/build/1")
+    previous := commentBody([]ModuleReport{
+        {Module: "feature-login", Outcome: OutcomeFailed, Reason: "build"},
+        {Module: "feature-cards", Outcome: OutcomeSkipped, Reason: "no changes"},
+    }, "https://app.bitrise.io/build/1")
+
+    var edited []string
+    var created string
+    comments := func(bodies ...string) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            switch {
+            case r.Method == "GET" && r.URL.Path == "/repos/owner/repo/issues/7/comments" && r.URL.Query().Get("page") == "1":
+                w.Header().Set("Link", `</repos/owner/repo/issues/7/comments?page=2>; rel="next"`)
+                fmt.Fprintf(w, `[{"id":1,"body":"LGTM"},{"id":2,"body":%q}]`, bodies[0])
+            case r.Method == "GET" && r.URL.Path == "/repos/owner/repo/issues/7/comments":
+                fmt.Fprintf(w, `[{"id":3,"body":%q}]`, bodies[1])
+            case r.Method == "PATCH":
+                var comment struct{ Body string }
+                require.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+                edited = append(edited, r.URL.Path + ": " + comment.Body)
+                fmt.Fprint(w, `{}`)
+            case r.Method == "POST" && r.URL.Path == "/repos/owner/repo/issues/7/comments":
+                var comment struct{ Body string }
+                require.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+                created = comment.Body
+                fmt.Fprint(w, `{}`)
+            default:
+                t.Errorf("unexpected request %s %s", r.Method, r.URL)
+            }
+        }
+    }
+
+    cfg := GitHubConfig{Owner: "owner", Repo: "repo"}
+    body := commentBody(testReports, "https://app.bitrise.io/build/2")
+    require.NoError(t, postComment(context.Background(), newTestClient(t, comments(otherStep, previous)), cfg, 7, testReports, "https://app.bitrise.io/build/2"))
+    require.Equal(t, []string{"/repos/owner/repo/issues/comments/3: " + body}, edited)
+    require.Empty(t, created)
+
+    edited = nil
+    require.NoError(t, postComment(context.Background(), newTestClient(t, comments(otherStep, "LGTM")), cfg, 7, testReports, "https://app.bitrise.io/build/2"))
+    require.Empty(t, edited)
+    require.Equal(t, body, created)
+}
+
+func TestPostStatuses(t *testing.T) {
+    var contexts []string
+    client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+        require.Equal(t, "/repos/owner/repo/statuses/abc123", r.URL.Path)
+        var status struct {
+            State, Description, Context string
+        }
+        require.NoError(t, json.NewDecoder(r.Body).Decode(&status))
+        contexts = append(contexts, status.Context + ": " + status.State + ", " + status.Description)
+        fmt.Fprint(w, `{}`)
+    })
+
+    cfg := GitHubConfig{Owner: "owner", Repo: "repo"}
+    require.NoError(t, postStatuses(context.Background(), client, cfg, "abc123", "", testReports))
+    require.Equal(t, []string{
+        "module-tests/feature-login: pending, tested – test workflows started",
+        "module-tests/feature-cards: success, skipped – no changes",
+    }, contexts)
+
+    require.Error(t, postStatuses(context.Background(), client, cfg, "", "", testReports))
+}
@@ -0,0 +1,89 @@
+package gitdiff
+
+import (
+    "fmt"
+    "github.com/bitrise-io/go-steputils/stepconf"
+    "github.com/bitrise-io/go-utils/command"
+    "github.com/bitrise-io/go-utils/log"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/diff"
+)
+
+type GitConfig struct {
+    BaseRef       string    `env:"change_base_ref"`
+    DestBranch    string    `env:"BITRISE_GIT_BRANCH_DEST"`
+    SourceDir     string    `env:"BITRISE_SOURCE_DIR"`
+}
+
+// ChangeSource lists the files changed between HEAD and a base commit of the local checkout.
+//
+// The base commit is, in order of preference:
+// - the change_base_ref input (a SHA or any ref git understands),
+// - the merge-base of HEAD and BITRISE_GIT_BRANCH_DEST (pull request builds),
+// - the parent of HEAD (push and tag builds).
+type ChangeSource struct {
+    cfg GitConfig
+}
+
+func NewChangeSource() (*ChangeSource, error) {
+    var cfg GitConfig
+    if err := stepconf.Parse(&cfg); err != nil {
+        return nil, err
+    }
+    return &ChangeSource{cfg: cfg}, nil
+}
+
+// NewChangeSourceForBranch diffs against the merge-base with the destination branch, unless change_base_ref is set.
+// Used when the destination branch is known from elsewhere than BITRISE_GIT_BRANCH_DEST, e.g. the pull request.
+func NewChangeSourceForBranch(branch string) (*ChangeSource, error) {
+    source, err := NewChangeSource()
+    if err != nil {
+        return nil, err
+    }
+    source.cfg.DestBranch = branch
+    return source, nil
+}
+
+func (s *ChangeSource) git(args ...string) (string, error) {
+    cmd := command.New("git", args...)
+    if s.cfg.SourceDir != "" {
+        cmd.SetDir(s.cfg.SourceDir)
+    }
+    out, err := cmd.RunAndReturnTrimmedOutput()
+    if err != nil {
+        return "", fmt.Errorf("%s failed, output: %s, error: %s", cmd.PrintableCommandArgs(), out, err)
+    }
+    return out, nil
+}
+
+func (s *ChangeSource) baseCommit() (string, error) {
+    if s.cfg.BaseRef != "" {
+        return s.git("rev-parse", "--verify", s.cfg.BaseRef + "^{commit}")
+    }
+
+    if s.cfg.DestBranch != "" {
+        if _, err := s.git("fetch", "--no-tags", "origin", s.cfg.DestBranch); err != nil {
+            log.Warnf("Failed to fetch %s, using the local copy: %s", s.cfg.DestBranch, err)
+        }
+        base, err := s.git("merge-base", "HEAD", "origin/" + s.cfg.DestBranch)
+        if err != nil {
+            return "", fmt.Errorf("no merge-base with %s, is the clone too shallow? %s", s.cfg.DestBranch, err)
+        }
+        return base, nil
+    }
+
+    return s.git("rev-parse", "--verify", "HEAD~1")
+}
+
+func (s *ChangeSource) ChangedFiles() ([]diff.File, error) {
+    base, err := s.baseCommit()
+    if err != nil {
+        return nil, err
+    }
+    log.Infof("Diffing HEAD against %s", base)
+
+    out, err := s.git("diff", "--name-status", "-M", base, "HEAD")
+    if err != nil {
+        return nil, err
+    }
+    return diff.ParseNameStatus(out)
+}
@@ -0,0 +1,69 @@
+package gitdiff
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/bitrise-io/go-utils/command"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/diff"
+    "github.com/stretchr/testify/require"
+)
+
+func commit(t *testing.T, dir, file string) {
+    pth := filepath.Join(dir, file)
+    if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+        t.Fatalf("setup: %s", err)
+    }
+    if err := ioutil.WriteFile(pth, []byte(file), 0644); err != nil {
+        t.Fatalf("setup: %s", err)
+    }
+    for _, args := range [][]string{{"add", "-A"}, {"commit", "-q", "-m", file}} {
+        cmd := command.New("git", args...).SetDir(dir)
+        cmd.AppendEnvs("GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+        if out, err := cmd.RunAndReturnTrimmedCombinedOutput(); err != nil {
+            t.Fatalf("setup: %s: %s", out, err)
+        }
+    }
+}
+
+func TestChangedFiles(t *testing.T) {
+    dir, err := ioutil.TempDir("", "gitdiff")
+    require.NoError(t, err)
+    defer os.RemoveAll(dir)
+
+    out, err := command.New("git", "init", "-q").SetDir(dir).RunAndReturnTrimmedCombinedOutput()
+    require.NoError(t, err, out)
+
+    commit(t, dir, "app/build.gradle")
+    base, err := command.New("git", "rev-parse", "HEAD").SetDir(dir).RunAndReturnTrimmedOutput()
+    require.NoError(t, err)
+    commit(t, dir, "features/login/src/main/Login.kt")
+    commit(t, dir, "core/src/main/Core.kt")
+
+    source := &ChangeSource{cfg: GitConfig{SourceDir: dir}}
+    files, err := source.ChangedFiles()
+    require.NoError(t, err)
+    require.Equal(t, []diff.File{{Path: "core/src/main/Core.kt", Status: diff.Added}}, files)
+
+    source = &ChangeSource{cfg: GitConfig{SourceDir: dir, BaseRef: base}}
+    files, err = source.ChangedFiles()
+    require.NoError(t, err)
+    require.Equal(t, []diff.File{
+        {Path: "core/src/main/Core.kt", Status: diff.Added},
+        {Path: "features/login/src/main/Login.kt", Status: diff.Added},
+    }, files)
+
+    require.NoError(t, os.MkdirAll(filepath.Join(dir, "features/signin/src/main"), 0755))
+    out, err = command.New("git", "mv", "features/login/src/main/Login.kt", "features/signin/src/main/Login.kt").SetDir(dir).RunAndReturnTrimmedCombinedOutput()
+    require.NoError(t, err, out)
+    commit(t, dir, "core/src/main/Core.kt")
+
+    source = &ChangeSource{cfg: GitConfig{SourceDir: dir}}
+    files, err = source.ChangedFiles()
+    require.NoError(t, err)
+    require.Equal(t, []diff.File{
+        {Path: "features/signin/src/main/Login.kt", PreviousPath: "features/login/src/main/Login.kt", Status: diff.Renamed},
+    }, files)
+}
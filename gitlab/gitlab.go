@@ -0,0 +1,119 @@
+package gitlab
+
+import (
+    "encoding/json"
+    "fmt"
+    "github.com/bitrise-io/go-steputils/stepconf"
+    "github.com/bitrise-io/go-utils/log"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/diff"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+)
+
+type GitLabConfig struct {
+    Token           string    `env:"gitlab_access_token,required"`
+    BaseURL         string    `env:"git_api_base_url"`
+    Owner           string    `env:"BITRISEIO_GIT_REPOSITORY_OWNER,required"`
+    Repo            string    `env:"BITRISEIO_GIT_REPOSITORY_SLUG,required"`
+    MergeRequest    string    `env:"PULL_REQUEST_ID"`
+}
+
+const (
+    defaultBaseURL = "https://gitlab.com/api/v4"
+    filesPerPage   = 100
+)
+
+// ChangeSource lists the files changed by the merge request under test using the GitLab API.
+type ChangeSource struct {
+    cfg       GitLabConfig
+    client    *http.Client
+}
+
+func NewChangeSource() (*ChangeSource, error) {
+    var cfg GitLabConfig
+    if err := stepconf.Parse(&cfg); err != nil {
+        return nil, err
+    }
+    if cfg.BaseURL == "" {
+        cfg.BaseURL = defaultBaseURL
+    }
+    return &ChangeSource{cfg: cfg, client: http.DefaultClient}, nil
+}
+
+// mergeRequestDiff is an entry of the merge request diffs endpoint.
+type mergeRequestDiff struct {
+    OldPath        string    `json:"old_path"`
+    NewPath        string    `json:"new_path"`
+    NewFile        bool      `json:"new_file"`
+    RenamedFile    bool      `json:"renamed_file"`
+    DeletedFile    bool      `json:"deleted_file"`
+}
+
+func (d mergeRequestDiff) file() diff.File {
+    switch {
+    case d.NewFile:
+        return diff.File{Path: d.NewPath, Status: diff.Added}
+    case d.DeletedFile:
+        return diff.File{Path: d.OldPath, Status: diff.Removed}
+    case d.RenamedFile:
+        return diff.File{Path: d.NewPath, PreviousPath: d.OldPath, Status: diff.Renamed}
+    }
+    return diff.File{Path: d.NewPath, Status: diff.Modified}
+}
+
+// get fetches a page of the API, explaining the usual causes of failures.
+func (s *ChangeSource) get(u string, v interface{}) (*http.Response, error) {
+    req, err := http.NewRequest("GET", u, nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("PRIVATE-TOKEN", s.cfg.Token)
+
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    switch {
+    case resp.StatusCode == http.StatusUnauthorized:
+        return nil, fmt.Errorf("%s, check gitlab_access_token", resp.Status)
+    case resp.StatusCode == http.StatusNotFound:
+        return nil, fmt.Errorf("%s, check the repository and that gitlab_access_token can access it", resp.Status)
+    case resp.StatusCode >= 300:
+        body, _ := ioutil.ReadAll(resp.Body)
+        return nil, fmt.Errorf("%s: %s", resp.Status, body)
+    }
+    return resp, json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (s *ChangeSource) ChangedFiles() ([]diff.File, error) {
+    if s.cfg.MergeRequest == "" {
+        return nil, fmt.Errorf("PULL_REQUEST_ID is not set, the gitlab change source only works in merge request builds, use the git change source otherwise")
+    }
+    number, err := strconv.Atoi(s.cfg.MergeRequest)
+    if err != nil {
+        return nil, fmt.Errorf("invalid PULL_REQUEST_ID (%s): %s", s.cfg.MergeRequest, err)
+    }
+
+    project := url.PathEscape(s.cfg.Owner + "/" + s.cfg.Repo)
+    var changedFiles []diff.File
+    for page := "1"; page != ""; {
+        log.Printf("Fetching page %s ...", page)
+        u := fmt.Sprintf("%s/projects/%s/merge_requests/%d/diffs?page=%s&per_page=%d", strings.TrimSuffix(s.cfg.BaseURL, "/"), project, number, page, filesPerPage)
+
+        var diffs []mergeRequestDiff
+        resp, err := s.get(u, &diffs)
+        if err != nil {
+            return nil, fmt.Errorf("failed to list the changes of merge request !%d of %s/%s: %s", number, s.cfg.Owner, s.cfg.Repo, err)
+        }
+        for _, d := range diffs {
+            changedFiles = append(changedFiles, d.file())
+        }
+        page = resp.Header.Get("X-Next-Page")
+    }
+    return changedFiles, nil
+}
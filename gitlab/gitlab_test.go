@@ -0,0 +1,49 @@
+package gitlab
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/diff"
+    "github.com/stretchr/testify/require"
+)
+
+func TestChangedFiles(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        require.Equal(t, "/api/v4/projects/group%2Fsub%2Frepo/merge_requests/12/diffs", r.URL.EscapedPath())
+        require.Equal(t, "secret", r.Header.Get("PRIVATE-TOKEN"))
+
+        switch r.URL.Query().Get("page") {
+        case "1":
+            w.Header().Set("X-Next-Page", "2")
+            fmt.Fprint(w, `[{"old_path":"features/a/Moved.kt","new_path":"features/b/Moved.kt","renamed_file":true},
+                {"old_path":"core/New.kt","new_path":"core/New.kt","new_file":true}]`)
+        case "2":
+            fmt.Fprint(w, `[{"old_path":"core/Old.kt","new_path":"core/Old.kt","deleted_file":true},
+                {"old_path":"app/build.gradle","new_path":"app/build.gradle"}]`)
+        }
+    }))
+    defer server.Close()
+
+    source := &ChangeSource{
+        cfg:    GitLabConfig{Token: "secret", BaseURL: server.URL + "/api/v4/", Owner: "group/sub", Repo: "repo", MergeRequest: "12"},
+        client: server.Client(),
+    }
+    files, err := source.ChangedFiles()
+    require.NoError(t, err)
+    require.Equal(t, []diff.File{
+        {Path: "features/b/Moved.kt", PreviousPath: "features/a/Moved.kt", Status: diff.Renamed},
+        {Path: "core/New.kt", Status: diff.Added},
+        {Path: "core/Old.kt", Status: diff.Removed},
+        {Path: "app/build.gradle", Status: diff.Modified},
+    }, files)
+
+    source.cfg.Token = "wrong"
+    server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusUnauthorized)
+    })
+    _, err = source.ChangedFiles()
+    require.EqualError(t, err, "failed to list the changes of merge request !12 of group/sub/repo: 401 Unauthorized, check gitlab_access_token")
+}
@@ -0,0 +1,98 @@
+package gradle
+
+import (
+    "fmt"
+    "strings"
+)
+
+// splitArgs splits a command line into arguments the way a shell would,
+// honoring single and double quotes and backslash escapes.
+func splitArgs(s string) ([]string, error) {
+    var args []string
+    var current strings.Builder
+    inArg := false
+    var quote rune
+    escaped := false
+
+    for _, r := range s {
+        switch {
+        case escaped:
+            current.WriteRune(r)
+            escaped = false
+        case r == '\\' && quote != '\'':
+            escaped = true
+            inArg = true
+        case quote != 0:
+            if r == quote {
+                quote = 0
+            } else {
+                current.WriteRune(r)
+            }
+        case r == '\'' || r == '"':
+            quote = r
+            inArg = true
+        case r == ' ' || r == '\t' || r == '\n':
+            if inArg {
+                args = append(args, current.String())
+                current.Reset()
+                inArg = false
+            }
+        default:
+            current.WriteRune(r)
+            inArg = true
+        }
+    }
+
+    if quote != 0 {
+        return nil, fmt.Errorf("unterminated %c quote in: %s", quote, s)
+    }
+    if escaped {
+        return nil, fmt.Errorf("trailing backslash in: %s", s)
+    }
+    if inArg {
+        args = append(args, current.String())
+    }
+    return args, nil
+}
+
+// gradleArgs returns the tasks and options of the Gradle invocation building the modules.
+// Extra tasks without a `:` are run in every module, the others are passed as is.
+func gradleArgs(cfg BuildConfig, moduleList []string) ([]string, error) {
+    var args []string
+    for _, module := range moduleList {
+        args = append(args, fmt.Sprintf("%s:assemble%s", module, cfg.Variant))
+        if cfg.BuildTestAPK {
+            args = append(args, fmt.Sprintf("%s:assemble%sAndroidTest", module, cfg.Variant))
+        }
+    }
+
+    extraTasks, err := splitArgs(cfg.Tasks)
+    if err != nil {
+        return nil, fmt.Errorf("invalid gradle_tasks: %s", err)
+    }
+    for _, task := range extraTasks {
+        if strings.Contains(task, ":") {
+            args = append(args, task)
+            continue
+        }
+        for _, module := range moduleList {
+            args = append(args, fmt.Sprintf("%s:%s", module, task))
+        }
+    }
+
+    if cfg.BuildCache {
+        args = append(args, "--build-cache")
+    }
+    if cfg.Offline {
+        args = append(args, "--offline")
+    }
+    if cfg.JVMArgs != "" {
+        args = append(args, "-Dorg.gradle.jvmargs=" + cfg.JVMArgs)
+    }
+
+    options, err := splitArgs(cfg.Options)
+    if err != nil {
+        return nil, fmt.Errorf("invalid gradle_options: %s", err)
+    }
+    return append(args, options...), nil
+}
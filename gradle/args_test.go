@@ -0,0 +1,43 @@
+package gradle
+
+import (
+    "testing"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestSplitArgs(t *testing.T) {
+    args, err := splitArgs(`--build-cache  -Pname="Neo Financial" -Pkey='a b'\ c --scan`)
+    require.NoError(t, err)
+    require.Equal(t, []string{"--build-cache", "-Pname=Neo Financial", "-Pkey=a b c", "--scan"}, args)
+
+    _, err = splitArgs(`-Pname="Neo`)
+    require.Error(t, err)
+}
+
+func TestGradleArgs(t *testing.T) {
+    args, err := gradleArgs(BuildConfig{
+        Variant:      "Debug",
+        BuildTestAPK: true,
+        Tasks:        "lintDebug :app:dependencies",
+        Options:      "--parallel -PenableCoverage=true",
+        BuildCache:   true,
+        Offline:      true,
+        JVMArgs:      "-Xmx4g -XX:MaxMetaspaceSize=1g",
+    }, []string{"feature-login", "feature-cards"})
+    require.NoError(t, err)
+    require.Equal(t, []string{
+        "feature-login:assembleDebug",
+        "feature-login:assembleDebugAndroidTest",
+        "feature-cards:assembleDebug",
+        "feature-cards:assembleDebugAndroidTest",
+        "feature-login:lintDebug",
+        "feature-cards:lintDebug",
+        ":app:dependencies",
+        "--build-cache",
+        "--offline",
+        "-Dorg.gradle.jvmargs=-Xmx4g -XX:MaxMetaspaceSize=1g",
+        "--parallel",
+        "-PenableCoverage=true",
+    }, args)
+}
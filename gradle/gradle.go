@@ -1,38 +1,180 @@
 package gradle
 
 import (
+    "context"
     "fmt"
     "github.com/bitrise-io/go-steputils/stepconf"
     "github.com/bitrise-io/go-utils/log"
     "github.com/bitrise-steplib/bitrise-step-build-router-start/execmd"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/modules"
     "github.com/bitrise-steplib/bitrise-step-build-router-start/util"
+    "path/filepath"
+    "time"
 )
 
 type BuildConfig struct {
-    Module      string     `env:"module,required"`
-    Variant     string     `env:"variant,required"`
-    DeployDir   string     `env:"deploy_path,required"`
-    APK         string     `env:"target_apk,required"`
+    Variant         string     `env:"variant,required"`
+    DeployDir       string     `env:"deploy_path,required"`
+    APK             string     `env:"target_apk"`
+    BuildTestAPK    bool       `env:"build_test_apk"`
+    Tasks           string     `env:"gradle_tasks"`
+    Options         string     `env:"gradle_options"`
+    BuildCache      bool       `env:"gradle_build_cache"`
+    Offline         bool       `env:"gradle_offline"`
+    JVMArgs         string     `env:"gradle_jvmargs"`
+    GradleOpts      string     `env:"gradle_opts"`
+    Timeout         int        `env:"gradle_timeout"`
 }
 
 var gradlew = "./gradlew"
 
-func Assemble() {
+func parseConfig() (BuildConfig, error) {
     var cfg BuildConfig
     if err := stepconf.Parse(&cfg); err != nil {
-        util.Failf("Issue with an input: %s", err)
+        return BuildConfig{}, util.ConfigErrorf("Issue with an input: %s", err)
     }
+    return cfg, nil
+}
 
-    log.Infof("Building %s %s", cfg.Module, cfg.Variant)
+// BuildPlan is the Gradle invocation Assemble runs.
+type BuildPlan struct {
+    Command       []string    `json:"command"`
+    GradleOpts    string      `json:"gradle_opts,omitempty"`
+    Timeout       int         `json:"timeout_minutes,omitempty"`
+}
 
-     cmd := fmt.Sprintf("%s:assemble%s", cfg.Module, cfg.Variant)
-     execmd.ExecuteRelativeCommand(gradlew, cmd)
+func planBuild(cfg BuildConfig, moduleList []string) (BuildPlan, error) {
+    args, err := gradleArgs(cfg, moduleList)
+    if err != nil {
+        return BuildPlan{}, util.ConfigErrorf("Issue with an input: %s", err)
+    }
+    return BuildPlan{
+        Command:    append([]string{gradlew}, args...),
+        GradleOpts: cfg.GradleOpts,
+        Timeout:    cfg.Timeout,
+    }, nil
 }
 
-func PrepareForDeploy() {
-    var cfg BuildConfig
-    if err := stepconf.Parse(&cfg); err != nil {
-        util.Failf("Issue with an input: %s", err)
+// PlanBuild returns the Gradle invocation building the modules, without running it.
+func PlanBuild(moduleList []string) (BuildPlan, error) {
+    cfg, err := parseConfig()
+    if err != nil {
+        return BuildPlan{}, err
+    }
+    return planBuild(cfg, moduleList)
+}
+
+// Assemble builds the variant of every module in a single Gradle invocation,
+// together with its instrumentation test APK if build_test_apk is set, and the extra tasks and options.
+func Assemble(moduleList []string) error {
+    cfg, err := parseConfig()
+    if err != nil {
+        return err
+    }
+
+    for _, module := range moduleList {
+        log.Infof("Building %s %s", module, cfg.Variant)
+    }
+    plan, err := planBuild(cfg, moduleList)
+    if err != nil {
+        return err
+    }
+
+    runner := execmd.Runner{
+        Stream:  true,
+        Timeout: time.Duration(plan.Timeout) * time.Minute,
+    }
+    if plan.GradleOpts != "" {
+        log.Infof("Set GRADLE_OPTS to [%s]", plan.GradleOpts)
+        runner.Env = []string{"GRADLE_OPTS=" + plan.GradleOpts}
+    }
+
+    result, err := runner.Run(context.Background(), plan.Command[0], plan.Command[1:]...)
+    if err != nil {
+        return fmt.Errorf("Gradle build failed: %s", err)
+    }
+    log.Donef("Gradle build finished in %s", result.Duration)
+    return nil
+}
+
+func targetName(cfg BuildConfig, module string) string {
+    if cfg.APK == "" {
+        return ""
+    }
+    return modules.ArtifactName(cfg.APK, module)
+}
+
+// PrepareForDeploy locates the APKs of the module in its Gradle outputs and copies them into the deploy directory.
+func PrepareForDeploy(layout *modules.Layout, module string) (Outputs, error) {
+    cfg, err := parseConfig()
+    if err != nil {
+        return Outputs{}, err
+    }
+
+    outputs, err := FindOutputs(layout.DirForModule(module), cfg.Variant, targetName(cfg, module), cfg.BuildTestAPK)
+    if err != nil {
+        return Outputs{}, fmt.Errorf("Failed to find the outputs of %s: %s", module, err)
+    }
+
+    deployed := map[string]string{}
+    for _, apk := range []string{outputs.TargetAPK, outputs.AppAPK, outputs.TestAPK} {
+        if apk == "" || deployed[apk] != "" {
+            continue
+        }
+        if deployed[apk], err = copyToDeployDir(apk, cfg.DeployDir); err != nil {
+            return Outputs{}, fmt.Errorf("Failed to copy %s to the deploy directory: %s", apk, err)
+        }
+    }
+    return Outputs{
+        AppAPK:    deployed[outputs.AppAPK],
+        TestAPK:   deployed[outputs.TestAPK],
+        TargetAPK: deployed[outputs.TargetAPK],
+    }, nil
+}
+
+// OutputsPlan is where PrepareForDeploy collects the APKs of a module from, and where it copies them to.
+type OutputsPlan struct {
+    APKDir       string     `json:"apk_dir"`
+    DeployDir    string     `json:"deploy_dir"`
+    // Outputs are the deploy paths of the APKs, as far as they are known before the build:
+    // the APKs already present in APKDir, e.g. from a previous build, or the target_apk name.
+    Outputs      Outputs    `json:"outputs"`
+    // Found are the APKs already present in APKDir, at their build output paths.
+    Found        Outputs    `json:"-"`
+}
+
+// PlanOutputs returns where the APKs of the module are collected from and copied to, without copying them.
+func PlanOutputs(layout *modules.Layout, module string) (OutputsPlan, error) {
+    cfg, err := parseConfig()
+    if err != nil {
+        return OutputsPlan{}, err
+    }
+
+    moduleDir := layout.DirForModule(module)
+    plan := OutputsPlan{
+        APKDir:    filepath.Join(moduleDir, "build", "outputs", "apk"),
+        DeployDir: cfg.DeployDir,
+    }
+
+    name := targetName(cfg, module)
+    if outputs, err := FindOutputs(moduleDir, cfg.Variant, name, cfg.BuildTestAPK); err == nil {
+        plan.Found = outputs
+        for _, apk := range []*string{&outputs.AppAPK, &outputs.TestAPK, &outputs.TargetAPK} {
+            if *apk != "" {
+                *apk = filepath.Join(cfg.DeployDir, filepath.Base(*apk))
+            }
+        }
+        plan.Outputs = outputs
+    } else if name != "" {
+        plan.Outputs.TargetAPK = filepath.Join(cfg.DeployDir, name)
+    }
+    return plan, nil
+}
+
+func copyToDeployDir(apk, deployDir string) (string, error) {
+    log.Infof("Found %s", apk)
+    if _, err := (execmd.Runner{}).Run(context.Background(), "cp", apk, deployDir); err != nil {
+        return "", err
     }
-    execmd.ExecuteCommand("find", ".", "-name", cfg.APK, "-exec", "cp", "{}", cfg.DeployDir, ";")
+    return filepath.Join(deployDir, filepath.Base(apk)), nil
 }
@@ -0,0 +1,166 @@
+package gradle
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// Outputs are the APKs built for a module: the app under test, if the module is an application,
+// the instrumentation test APK, if it was built, and the APK to test selected by target_apk.
+type Outputs struct {
+    AppAPK       string    `json:"app_apk,omitempty"`
+    TestAPK      string    `json:"test_apk,omitempty"`
+    TargetAPK    string    `json:"target_apk,omitempty"`
+}
+
+// outputMetadata is the output-metadata.json written by AGP next to the APKs of a variant.
+type outputMetadata struct {
+    VariantName    string    `json:"variantName"`
+    Elements       []struct {
+        OutputFile    string    `json:"outputFile"`
+    } `json:"elements"`
+}
+
+const outputMetadataFile = "output-metadata.json"
+
+// isVariantDir reports whether an APK output directory, relative to build/outputs/apk, belongs to the variant,
+// e.g. `staging/debug` belongs to `StagingDebug`.
+func isVariantDir(dir, variant string) bool {
+    return strings.EqualFold(strings.Replace(filepath.ToSlash(dir), "/", "", -1), variant)
+}
+
+// variantDirs returns the output directories of the variant, e.g. `build/outputs/apk/staging/debug`.
+func variantDirs(apkDir, variant string) ([]string, error) {
+    var dirs []string
+    err := filepath.Walk(apkDir, func(pth string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if !info.IsDir() {
+            return nil
+        }
+        rel, err := filepath.Rel(apkDir, pth)
+        if err != nil {
+            return err
+        }
+        if isVariantDir(rel, variant) {
+            dirs = append(dirs, pth)
+        }
+        return nil
+    })
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    return dirs, err
+}
+
+// apksInDir returns the APKs listed in the output-metadata.json of the directory,
+// or, for older AGP versions which do not write it, the APKs found in the directory.
+func apksInDir(dir, variant string) ([]string, error) {
+    content, err := ioutil.ReadFile(filepath.Join(dir, outputMetadataFile))
+    if os.IsNotExist(err) {
+        return filepath.Glob(filepath.Join(dir, "*.apk"))
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    var metadata outputMetadata
+    if err := json.Unmarshal(content, &metadata); err != nil {
+        return nil, fmt.Errorf("failed to parse %s: %s", filepath.Join(dir, outputMetadataFile), err)
+    }
+    if metadata.VariantName != "" && !strings.EqualFold(metadata.VariantName, variant) {
+        return nil, nil
+    }
+
+    var apks []string
+    for _, element := range metadata.Elements {
+        if filepath.Ext(element.OutputFile) == ".apk" {
+            apks = append(apks, filepath.Join(dir, element.OutputFile))
+        }
+    }
+    return apks, nil
+}
+
+// findAPKs returns the APKs of the variant in the output directory, e.g. build/outputs/apk.
+// metadataVariant is the variant name recorded in output-metadata.json, e.g. `debugAndroidTest` for test APKs.
+func findAPKs(apkDir, variant, metadataVariant string) ([]string, error) {
+    dirs, err := variantDirs(apkDir, variant)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list %s: %s", apkDir, err)
+    }
+
+    var apks []string
+    for _, dir := range dirs {
+        dirAPKs, err := apksInDir(dir, metadataVariant)
+        if err != nil {
+            return nil, err
+        }
+        apks = append(apks, dirAPKs...)
+    }
+    sort.Strings(apks)
+    return apks, nil
+}
+
+func single(apks []string, description, apkDir string) (string, error) {
+    switch len(apks) {
+    case 0:
+        return "", fmt.Errorf("no %s found in %s", description, apkDir)
+    case 1:
+        return apks[0], nil
+    }
+    return "", fmt.Errorf("%d %ss found in %s, set target_apk to select one of them: %s", len(apks), description, apkDir, strings.Join(apks, ", "))
+}
+
+// FindOutputs locates the APKs of the variant in build/outputs/apk of the module.
+// The target is the APK named targetName if set, otherwise the test APK if it was built, otherwise the app APK.
+func FindOutputs(moduleDir, variant, targetName string, withTestAPK bool) (Outputs, error) {
+    apkDir := filepath.Join(moduleDir, "build", "outputs", "apk")
+
+    appAPKs, err := findAPKs(apkDir, variant, variant)
+    if err != nil {
+        return Outputs{}, err
+    }
+    testAPKs, err := findAPKs(filepath.Join(apkDir, "androidTest"), variant, variant + "AndroidTest")
+    if err != nil {
+        return Outputs{}, err
+    }
+
+    var outputs Outputs
+    if withTestAPK {
+        if outputs.TestAPK, err = single(testAPKs, variant + " test APK", apkDir); err != nil {
+            return Outputs{}, err
+        }
+        if len(appAPKs) > 0 {
+            if outputs.AppAPK, err = single(appAPKs, variant + " APK", apkDir); err != nil {
+                return Outputs{}, err
+            }
+        }
+    }
+
+    if targetName != "" {
+        var targets []string
+        for _, apk := range append(appAPKs, testAPKs...) {
+            if filepath.Base(apk) == targetName {
+                targets = append(targets, apk)
+            }
+        }
+        if len(targets) == 0 {
+            return Outputs{}, fmt.Errorf("no %s found in %s, found: %s", targetName, apkDir, strings.Join(append(appAPKs, testAPKs...), ", "))
+        }
+        outputs.TargetAPK, err = single(targets, targetName, apkDir)
+    } else if withTestAPK {
+        outputs.TargetAPK = outputs.TestAPK
+    } else {
+        outputs.TargetAPK, err = single(appAPKs, variant + " APK", apkDir)
+    }
+    if err != nil {
+        return Outputs{}, err
+    }
+    return outputs, nil
+}
@@ -0,0 +1,64 @@
+package gradle
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/stretchr/testify/require"
+)
+
+func writeOutputs(t *testing.T, files map[string]string) string {
+    dir, err := ioutil.TempDir("", "outputs")
+    require.NoError(t, err)
+    for name, content := range files {
+        pth := filepath.Join(dir, name)
+        require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0755))
+        require.NoError(t, ioutil.WriteFile(pth, []byte(content), 0644))
+    }
+    return dir
+}
+
+func TestFindOutputs(t *testing.T) {
+    dir := writeOutputs(t, map[string]string{
+        "app/build/outputs/apk/staging/debug/app-staging-debug.apk": "",
+        "app/build/outputs/apk/staging/debug/output-metadata.json": `{
+  "version": 3,
+  "variantName": "stagingDebug",
+  "elements": [{"type": "SINGLE", "outputFile": "app-staging-debug.apk"}]
+}`,
+        "app/build/outputs/apk/staging/debug/stale.apk":                                   "",
+        "app/build/outputs/apk/production/debug/app-production-debug.apk":                 "",
+        "app/build/outputs/apk/androidTest/staging/debug/app-staging-debug-androidTest.apk": "",
+        "login/build/outputs/apk/androidTest/debug/feature-login-debug-androidTest.apk":     "",
+        "splits/build/outputs/apk/debug/splits-arm64-v8a-debug.apk":                        "",
+        "splits/build/outputs/apk/debug/splits-x86-debug.apk":                              "",
+    })
+    defer os.RemoveAll(dir)
+
+    outputs, err := FindOutputs(filepath.Join(dir, "app"), "StagingDebug", "", true)
+    require.NoError(t, err)
+    require.Equal(t, Outputs{
+        AppAPK:    filepath.Join(dir, "app/build/outputs/apk/staging/debug/app-staging-debug.apk"),
+        TestAPK:   filepath.Join(dir, "app/build/outputs/apk/androidTest/staging/debug/app-staging-debug-androidTest.apk"),
+        TargetAPK: filepath.Join(dir, "app/build/outputs/apk/androidTest/staging/debug/app-staging-debug-androidTest.apk"),
+    }, outputs)
+
+    outputs, err = FindOutputs(filepath.Join(dir, "app"), "ProductionDebug", "", false)
+    require.NoError(t, err)
+    require.Equal(t, filepath.Join(dir, "app/build/outputs/apk/production/debug/app-production-debug.apk"), outputs.TargetAPK)
+
+    outputs, err = FindOutputs(filepath.Join(dir, "login"), "Debug", "feature-login-debug-androidTest.apk", false)
+    require.NoError(t, err)
+    require.Equal(t, Outputs{
+        TargetAPK: filepath.Join(dir, "login/build/outputs/apk/androidTest/debug/feature-login-debug-androidTest.apk"),
+    }, outputs)
+
+    _, err = FindOutputs(filepath.Join(dir, "app"), "ProductionDebug", "", true)
+    require.Error(t, err)
+
+    _, err = FindOutputs(filepath.Join(dir, "splits"), "Debug", "", false)
+    require.EqualError(t, err, "2 Debug APKs found in "+filepath.Join(dir, "splits/build/outputs/apk")+", set target_apk to select one of them: "+
+        filepath.Join(dir, "splits/build/outputs/apk/debug/splits-arm64-v8a-debug.apk")+", "+filepath.Join(dir, "splits/build/outputs/apk/debug/splits-x86-debug.apk"))
+}
@@ -0,0 +1,165 @@
+package instrument
+
+import (
+    "encoding/json"
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// JUnit5RunnerBuilder runs JUnit 5 tests with the android-junit5 instrumentation.
+const JUnit5RunnerBuilder = "de.mannodermaus.junit5.AndroidJUnit5Builder"
+
+// Arg is an instrumentation argument, passed as `-e key value`.
+type Arg struct {
+    Key      string    `json:"key"`
+    Value    string    `json:"value"`
+}
+
+// Command is an `am instrument` invocation running the tests of a test package.
+type Command struct {
+    TestPackage         string
+    Runner              string
+    RunnerBuilder       string
+    Classes             []string
+    Packages            []string
+    Annotation          string
+    NotAnnotation       string
+    Size                string
+    NumShards           int
+    ShardIndex          int
+    ClearPackageData    bool
+    Coverage            bool
+    // Args are passed as is, after the ones above.
+    Args                []Arg
+}
+
+var sizes = map[string]bool{"": true, "small": true, "medium": true, "large": true}
+
+// Validate reports arguments the runner would reject or silently ignore.
+func (c Command) Validate() error {
+    if c.TestPackage == "" || c.Runner == "" {
+        return fmt.Errorf("test package and runner are required")
+    }
+    if !sizes[c.Size] {
+        return fmt.Errorf("invalid test size (%s), expected small, medium or large", c.Size)
+    }
+    if c.NumShards < 0 || c.ShardIndex < 0 {
+        return fmt.Errorf("shard count and index can't be negative")
+    }
+    if c.NumShards == 0 && c.ShardIndex > 0 {
+        return fmt.Errorf("shard index %d without a shard count", c.ShardIndex)
+    }
+    if c.NumShards > 0 && c.ShardIndex >= c.NumShards {
+        return fmt.Errorf("shard index %d out of %d shards", c.ShardIndex, c.NumShards)
+    }
+    return nil
+}
+
+// Arguments returns the `-e` arguments of the command, in the order they are passed.
+func (c Command) Arguments() []Arg {
+    var args []Arg
+    add := func(key, value string) {
+        if value != "" {
+            args = append(args, Arg{Key: key, Value: value})
+        }
+    }
+    add("runnerBuilder", c.RunnerBuilder)
+    add("class", strings.Join(c.Classes, ","))
+    add("package", strings.Join(c.Packages, ","))
+    add("annotation", c.Annotation)
+    add("notAnnotation", c.NotAnnotation)
+    add("size", c.Size)
+    if c.NumShards > 0 {
+        add("numShards", strconv.Itoa(c.NumShards))
+        add("shardIndex", strconv.Itoa(c.ShardIndex))
+    }
+    if c.ClearPackageData {
+        add("clearPackageData", "true")
+    }
+    if c.Coverage {
+        add("coverage", "true")
+    }
+    return append(args, c.Args...)
+}
+
+// RemoteCommand returns the `am instrument` command line run on the device, with raw (-r) output and waiting (-w) for the tests.
+// The arguments are quoted for the device's shell, which parses the command again after adb joined its arguments.
+func (c Command) RemoteCommand() string {
+    quoted := []string{"am", "instrument", "-r", "-w"}
+    for _, arg := range c.Arguments() {
+        quoted = append(quoted, "-e", Quote(arg.Key), Quote(arg.Value))
+    }
+    return strings.Join(append(quoted, Quote(c.TestPackage + "/" + c.Runner)), " ")
+}
+
+// Argv returns the adb command line: `adb shell` and the remote command as a single argument.
+func (c Command) Argv() []string {
+    return []string{"adb", "shell", c.RemoteCommand()}
+}
+
+var safeArgRegexp = regexp.MustCompile(`^[A-Za-z0-9_./:,=@%+-]+$`)
+
+// Quote quotes the argument for a POSIX shell, if needed.
+func Quote(arg string) string {
+    if safeArgRegexp.MatchString(arg) {
+        return arg
+    }
+    return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+// String returns the adb command line, quoted for the local shell.
+func (c Command) String() string {
+    var quoted []string
+    for _, arg := range c.Argv() {
+        quoted = append(quoted, Quote(arg))
+    }
+    return strings.Join(quoted, " ")
+}
+
+// JSON returns the command in a form runners other than adb can use, e.g. to pass the arguments to a device farm.
+func (c Command) JSON() (string, error) {
+    arguments := c.Arguments()
+    if arguments == nil {
+        arguments = []Arg{}
+    }
+    b, err := json.Marshal(struct {
+        TestPackage    string      `json:"test_package"`
+        Runner         string      `json:"runner"`
+        Arguments      []Arg       `json:"arguments"`
+        Argv           []string    `json:"argv"`
+    }{c.TestPackage, c.Runner, arguments, c.Argv()})
+    if err != nil {
+        return "", err
+    }
+    return string(b), nil
+}
+
+// ParseArgs parses `key value` or `key=value` pairs, one per line. Blank lines and `#` comments are skipped.
+func ParseArgs(list string) ([]Arg, error) {
+    var args []Arg
+    for _, line := range strings.Split(list, "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        i := strings.IndexAny(line, " \t=")
+        if i <= 0 {
+            return nil, fmt.Errorf("invalid instrumentation argument (%s), expected `key value`", line)
+        }
+        args = append(args, Arg{Key: line[:i], Value: strings.TrimSpace(line[i + 1:])})
+    }
+    return args, nil
+}
+
+// SplitList splits a comma or newline separated list.
+func SplitList(list string) []string {
+    var items []string
+    for _, item := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == '\n' }) {
+        if item = strings.TrimSpace(item); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
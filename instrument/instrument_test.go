@@ -0,0 +1,82 @@
+package instrument
+
+import (
+    "testing"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestCommand(t *testing.T) {
+    command := Command{
+        TestPackage:      "com.example.test",
+        Runner:           "androidx.test.runner.AndroidJUnitRunner",
+        RunnerBuilder:    JUnit5RunnerBuilder,
+        Classes:          []string{"com.example.LoginTest#validPassword", "com.example.SignUpTest"},
+        NotAnnotation:    "androidx.test.filters.FlakyTest",
+        Size:             "medium",
+        NumShards:        4,
+        ShardIndex:       1,
+        ClearPackageData: true,
+        Args:             []Arg{{Key: "listener", Value: "com.example.Listener"}, {Key: "greeting", Value: "it's me"}},
+    }
+    require.NoError(t, command.Validate())
+
+    remote := "am instrument -r -w"+
+        " -e runnerBuilder de.mannodermaus.junit5.AndroidJUnit5Builder"+
+        " -e class 'com.example.LoginTest#validPassword,com.example.SignUpTest'"+
+        " -e notAnnotation androidx.test.filters.FlakyTest"+
+        " -e size medium -e numShards 4 -e shardIndex 1 -e clearPackageData true"+
+        " -e listener com.example.Listener -e greeting 'it'\\''s me'"+
+        " com.example.test/androidx.test.runner.AndroidJUnitRunner"
+    require.Equal(t, remote, command.RemoteCommand())
+    require.Equal(t, []string{"adb", "shell", remote}, command.Argv())
+
+    // Quoted for the device's shell, then once more for the local one.
+    require.Equal(t, "adb shell 'am instrument -r -w"+
+        " -e runnerBuilder de.mannodermaus.junit5.AndroidJUnit5Builder"+
+        ` -e class '\''com.example.LoginTest#validPassword,com.example.SignUpTest'\''`+
+        " -e notAnnotation androidx.test.filters.FlakyTest"+
+        " -e size medium -e numShards 4 -e shardIndex 1 -e clearPackageData true"+
+        ` -e listener com.example.Listener -e greeting '\''it'\''\'\'''\''s me'\''`+
+        " com.example.test/androidx.test.runner.AndroidJUnitRunner'", command.String())
+
+    value, err := Command{TestPackage: "com.example.test", Runner: "Runner", Coverage: true}.JSON()
+    require.NoError(t, err)
+    require.Equal(t, `{"test_package":"com.example.test","runner":"Runner",`+
+        `"arguments":[{"key":"coverage","value":"true"}],`+
+        `"argv":["adb","shell","am instrument -r -w -e coverage true com.example.test/Runner"]}`, value)
+}
+
+func TestCommand_Validate(t *testing.T) {
+    valid := Command{TestPackage: "com.example.test", Runner: "Runner"}
+    require.NoError(t, valid.Validate())
+
+    for _, invalid := range []Command{
+        {},
+        {TestPackage: "com.example.test", Runner: "Runner", Size: "huge"},
+        {TestPackage: "com.example.test", Runner: "Runner", NumShards: 2, ShardIndex: 2},
+        {TestPackage: "com.example.test", Runner: "Runner", ShardIndex: 1},
+    } {
+        require.Error(t, invalid.Validate(), "%+v", invalid)
+    }
+}
+
+func TestParseArgs(t *testing.T) {
+    args, err := ParseArgs(`
+# listeners
+listener com.example.Listener
+debug=false
+  timeout_msec   60000
+`)
+    require.NoError(t, err)
+    require.Equal(t, []Arg{
+        {Key: "listener", Value: "com.example.Listener"},
+        {Key: "debug", Value: "false"},
+        {Key: "timeout_msec", Value: "60000"},
+    }, args)
+
+    _, err = ParseArgs("lonely")
+    require.Error(t, err)
+
+    require.Equal(t, []string{"com.a", "com.b", "com.c"}, SplitList("com.a, com.b\ncom.c,"))
+}
@@ -1,100 +1,262 @@
 package main
 
 import (
-    "fmt"
     "os"
     "strings"
-    "time"
     "github.com/bitrise-io/go-utils/log"
     "github.com/bitrise-steplib/bitrise-step-build-router-start/env"
     "github.com/bitrise-steplib/bitrise-step-build-router-start/execmd"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gh"
     "github.com/bitrise-steplib/bitrise-step-build-router-start/gradle"
     "github.com/bitrise-steplib/bitrise-step-build-router-start/deploy"
     "github.com/bitrise-steplib/bitrise-step-build-router-start/trigger"
-    "github.com/bitrise-steplib/bitrise-step-build-router-start/gh"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/changes"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/modules"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/pipeline"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/plan"
     "github.com/bitrise-io/go-steputils/stepconf"
     "github.com/bitrise-steplib/bitrise-step-build-router-start/util"
 )
 
 func DisplayInfo() {
     log.Infof("=== Display environment info ===")
-    execmd.ExecuteCommand("go", "version")
-    execmd.ExecuteCommand("git", "--version")
-    execmd.ExecuteCommand("adb", "--version")
-    execmd.ExecuteRelativeCommand("./gradlew", "--version")
+    for _, args := range [][]string{{"go", "version"}, {"git", "--version"}, {"adb", "--version"}, {"./gradlew", "--version"}} {
+        if err := execmd.ExecuteCommand(args[0], args[1:]...); err != nil {
+            log.Warnf("%s", err)
+        }
+    }
 }
 
 type PathConfig struct {
-    Module      string     `env:"module,required"`
+    Module      string     `env:"module"`
+    Modules     string     `env:"modules"`
 }
 
-func checkIfTestsExist(testPath string) bool {
-    log.Infof("Checking for tests in %s", testPath)
-    var root = fmt.Sprintf("./%s", testPath)
-    if _, err := os.Stat(root); !os.IsNotExist(err) {
-        log.Infof("OK. Found %s!\n", testPath)
-        return true
-    }
-    return false
+type RunConfig struct {
+    DryRun         bool       `env:"dry_run"`
+    TimingsPath    string     `env:"stage_timings_path"`
 }
 
-func isSkippable(module string) bool {
+const (
+    envFailureReason = "BUILD_MODULE_FAILURE_REASON"
+    envStageTimings  = "BUILD_MODULE_STAGE_TIMINGS"
+    envPlan          = "BUILD_MODULE_PLAN"
+)
+
+// selectModules returns the modules to build out of the candidates, i.e. the ones that have tests and changes,
+// and the reports of the skipped ones.
+func selectModules(layout *modules.Layout, candidates []string) ([]string, []gh.ModuleReport, error) {
+    var withTests []string
+    var skipped []gh.ModuleReport
+    for _, module := range candidates {
+        detection, err := layout.DetectTests(module)
+        if err != nil {
+            return nil, nil, err
+        }
+        if !detection.HasTests {
+            log.Errorf("No tests detected in %s. Skipping build", module)
+            skipped = append(skipped, gh.ModuleReport{Module: module, Outcome: gh.OutcomeSkipped, Reason: "no tests"})
+            continue
+        }
+        withTests = append(withTests, module)
+    }
+    if len(withTests) == 0 {
+        return nil, skipped, nil
+    }
+
+    changed, err := changes.GetChangedModules(layout)
+    if err != nil {
+        return nil, nil, util.Classify(util.FailureChanges, err)
+    }
 
-    testModuleDir := strings.TrimPrefix(module, "feature-")
-    testPath := fmt.Sprintf("features/%s/src/androidTest", testModuleDir)
-    exists := checkIfTestsExist(testPath)
-    if !exists {
-        log.Errorf("No tests detected in %s. Skipping build", module)
-        return true
+    var selected []string
+    for _, module := range withTests {
+        if !changed.Contains(module) {
+            log.Errorf("No changes detected in %s. Skipping build", module)
+            skipped = append(skipped, gh.ModuleReport{Module: module, Outcome: gh.OutcomeSkipped, Reason: "no changes"})
+            continue
+        }
+        log.Infof("Changes to module %s found. Running tests.", module)
+        selected = append(selected, module)
     }
+    return selected, skipped, nil
+}
 
-    modules := gh.GetChangedModules()
-    if modules[module] == false {
-        log.Errorf("No changes detected in %s. Skipping build", module)
-        return true
+// reportToPullRequest posts the outcome of every candidate module to the pull request,
+// by the results of its test builds if they were waited for. Failing to do so doesn't fail the step.
+func reportToPullRequest(moduleList []string, skipped []gh.ModuleReport, results []trigger.Result, err error) {
+    var reports []gh.ModuleReport
+    for _, module := range moduleList {
+        report := gh.TestReport(module, results)
+        if report.Outcome == gh.OutcomeTested && err != nil {
+            report = gh.ModuleReport{Module: module, Outcome: gh.OutcomeFailed, Reason: string(util.Reason(err))}
+        }
+        reports = append(reports, report)
+    }
+    if reportErr := gh.Report(append(reports, skipped...)); reportErr != nil {
+        log.Warnf("Failed to report to the pull request: %s", reportErr)
     }
-    log.Infof("Changes to module %s found. Running tests.", module)
-    return false
 }
 
-func buildAndTrigger() {
-    timestamp()
-    gradle.Assemble()
-    timestamp()
-    gradle.PrepareForDeploy()
-    timestamp()
-    env.SetTargetEnv()
-    timestamp()
-    deploy.Deploy()
-    timestamp()
-    trigger.TriggerWorkflow()
-    timestamp()
+// addBuildStages adds the stages building the selected modules and triggering their test workflows, whose results it collects.
+func addBuildStages(p *pipeline.Pipeline, layout *modules.Layout, moduleList *[]string, results *[]trigger.Result) {
+    noModules := func() (bool, string) {
+        return len(*moduleList) == 0, "no module to build"
+    }
+
+    outputs := map[string]gradle.Outputs{}
+    var groups []trigger.Group
+
+    p.Add(pipeline.Stage{Name: "assemble", Skip: noModules, Run: func() error {
+        log.Infof("Building %s", strings.Join(*moduleList, ", "))
+        return util.Classify(util.FailureBuild, gradle.Assemble(*moduleList))
+    }})
+    p.Add(pipeline.Stage{Name: "collect outputs", Skip: noModules, Run: func() error {
+        for _, module := range *moduleList {
+            moduleOutputs, err := gradle.PrepareForDeploy(layout, module)
+            if err != nil {
+                return util.Classify(util.FailureBuild, err)
+            }
+            outputs[module] = moduleOutputs
+        }
+        return nil
+    }})
+    p.Add(pipeline.Stage{Name: "target environment", Skip: noModules, Run: func() error {
+        for _, module := range *moduleList {
+            shards, err := env.SetTargetEnv(module, outputs[module])
+            if err != nil {
+                return util.Classify(util.FailureTrigger, err)
+            }
+            for i, variables := range shards {
+                values := env.Values(module, variables)
+                for key, value := range gh.StatusEnv(module) {
+                    values[key] = value
+                }
+                environments, err := trigger.SharedEnvironmentsWith(values)
+                if err != nil {
+                    return err
+                }
+                groups = append(groups, trigger.Group{Name: env.ShardName(module, i, len(shards)), Module: module, Environments: environments})
+            }
+        }
+        return nil
+    }})
+    p.Add(pipeline.Stage{Name: "deploy", Skip: noModules, Run: func() error {
+        return util.Classify(util.FailureUpload, deploy.Deploy())
+    }})
+    p.Add(pipeline.Stage{Name: "trigger", Skip: noModules, Run: func() error {
+        var err error
+        *results, err = trigger.TriggerWorkflows(groups)
+        return util.Classify(util.FailureTrigger, err)
+    }})
 }
 
-var startTime int64 = 0
+// addPlanStage adds the stage printing and exporting what the build stages would do, instead of doing it.
+func addPlanStage(p *pipeline.Pipeline, layout *modules.Layout, moduleList *[]string) {
+    p.Add(pipeline.Stage{Name: "plan", Run: func() error {
+        resolved, err := plan.Resolve(layout, *moduleList)
+        if err != nil {
+            return err
+        }
+        resolved.Print(os.Stdout)
 
-func timestamp() {
-    log.Infof("[Time] %d", time.Now().UnixNano() / int64(time.Millisecond) - startTime)
+        value, err := resolved.JSON()
+        if err != nil {
+            return err
+        }
+        return execmd.ExportEnv(envPlan, value)
+    }})
 }
 
-func main() {
-    startTime = time.Now().UnixNano() / int64(time.Millisecond)
-    timestamp()
+// report prints the stage summary and exports the timings.
+func report(p *pipeline.Pipeline, cfg RunConfig) {
+    log.Infof("=== Stage summary ===")
+    p.PrintSummary(os.Stdout)
+
+    timings, err := p.JSON()
+    if err != nil {
+        log.Warnf("Failed to encode the stage timings: %s", err)
+        return
+    }
+    if err := execmd.ExportEnv(envStageTimings, timings); err != nil {
+        log.Warnf("%s", err)
+    }
+    if cfg.TimingsPath != "" {
+        if err := p.WriteJSON(cfg.TimingsPath); err != nil {
+            log.Warnf("Failed to write the stage timings to %s: %s", cfg.TimingsPath, err)
+        }
+    }
+}
+
+// fail reports the failure and exits with the exit code of its reason.
+func fail(err error) {
+    reason := util.Reason(err)
+    log.Errorf("%s", err)
+    log.Errorf("Failure reason: %s", reason)
+    if exportErr := execmd.ExportEnv(envFailureReason, string(reason)); exportErr != nil {
+        log.Warnf("%s", exportErr)
+    }
+    os.Exit(util.ExitCode(err))
+}
+
+func run() error {
     var cfg PathConfig
     if err := stepconf.Parse(&cfg); err != nil {
-        util.Failf("Issue with an input: %s", err)
+        return util.ConfigErrorf("Issue with an input: %s", err)
+    }
+    var runCfg RunConfig
+    if err := stepconf.Parse(&runCfg); err != nil {
+        return util.ConfigErrorf("Issue with an input: %s", err)
     }
-    timestamp()
     // DisplayInfo()
 
-    if isSkippable(cfg.Module) {
-        os.Exit(0)
+    layout, err := modules.LoadLayout()
+    if err != nil {
+        return err
     }
 
-    log.Infof("Building %s", cfg.Module)
-    timestamp()
-    buildAndTrigger()
+    var candidates []string
+    if cfg.Modules != "" {
+        candidates = layout.Select(cfg.Modules)
+    } else if cfg.Module != "" {
+        candidates = []string{cfg.Module}
+    } else {
+        return util.ConfigErrorf("Issue with an input: either module or modules is required")
+    }
 
-    os.Exit(0)
+    var moduleList []string
+    var skipped []gh.ModuleReport
+    var results []trigger.Result
+    p := pipeline.New()
+    p.Add(pipeline.Stage{Name: "select modules", Run: func() error {
+        moduleList, skipped, err = selectModules(layout, candidates)
+        return err
+    }})
+    if runCfg.DryRun {
+        log.Warnf("Dry run, nothing is built, deployed or triggered")
+        addPlanStage(p, layout, &moduleList)
+    } else {
+        addBuildStages(p, layout, &moduleList, &results)
+    }
+
+    err = p.Run()
+    if !runCfg.DryRun {
+        reportToPullRequest(moduleList, skipped, results, err)
+    }
+    report(p, runCfg)
+    return err
 }
 
+func main() {
+    if len(os.Args) > 1 {
+        if err := runCommand(os.Args[1:]); err != nil {
+            fail(err)
+        }
+        os.Exit(0)
+    }
+
+    if err := run(); err != nil {
+        fail(err)
+    }
+    os.Exit(0)
+}
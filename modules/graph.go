@@ -0,0 +1,171 @@
+package modules
+
+import (
+    "fmt"
+    "github.com/bitrise-io/go-utils/log"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strings"
+)
+
+// Project is a Gradle project declared in settings.gradle(.kts).
+// Path is the Gradle project path without the leading colon, e.g. `feature-login` or `libraries:design`.
+type Project struct {
+    Path            string
+    Dir             string
+    Dependencies    []string
+}
+
+// Graph is the project dependency graph of a multi-module Gradle build.
+type Graph struct {
+    projects      map[string]*Project
+    dependents    map[string][]string
+}
+
+var settingsFiles = []string{"settings.gradle", "settings.gradle.kts"}
+var buildFiles = []string{"build.gradle", "build.gradle.kts"}
+
+var (
+    blockCommentRegexp  = regexp.MustCompile(`(?s)/\*.*?\*/`)
+    lineCommentRegexp   = regexp.MustCompile(`(?m)(^|\s)//.*$`)
+    includeRegexp       = regexp.MustCompile(`(?m)^\s*include\b[ \t(]*((?:[^\n]*,[ \t]*\n)*[^\n]*)`)
+    quotedPathRegexp    = regexp.MustCompile(`["']:?([^"']+)["']`)
+    projectDirRegexp    = regexp.MustCompile(`project\(\s*["']:?([^"']+)["']\s*\)\.projectDir\s*=\s*(?:new\s+)?(?:file|File)\(\s*(?:(?:rootDir|settingsDir|rootProject\.projectDir)\s*,\s*)?["']([^"']+)["']`)
+    projectDepRegexp    = regexp.MustCompile(`project\(\s*(?:path\s*[:=]\s*)?["']:?([^"']+)["']`)
+)
+
+func stripComments(content string) string {
+    content = blockCommentRegexp.ReplaceAllString(content, "")
+    return lineCommentRegexp.ReplaceAllString(content, "$1")
+}
+
+func readFirst(dir string, names []string) (string, bool, error) {
+    for _, name := range names {
+        content, err := ioutil.ReadFile(filepath.Join(dir, name))
+        if os.IsNotExist(err) {
+            continue
+        }
+        if err != nil {
+            return "", false, err
+        }
+        return stripComments(string(content)), true, nil
+    }
+    return "", false, nil
+}
+
+// parseSettings returns the included projects with their directories relative to the root project.
+func parseSettings(content string) map[string]*Project {
+    projects := map[string]*Project{}
+    for _, include := range includeRegexp.FindAllStringSubmatch(content, -1) {
+        for _, match := range quotedPathRegexp.FindAllStringSubmatch(include[1], -1) {
+            path := match[1]
+            projects[path] = &Project{
+                Path: path,
+                Dir:  strings.Replace(path, ":", "/", -1),
+            }
+        }
+    }
+
+    for _, match := range projectDirRegexp.FindAllStringSubmatch(content, -1) {
+        if project, ok := projects[match[1]]; ok {
+            project.Dir = filepath.ToSlash(filepath.Clean(match[2]))
+        }
+    }
+    return projects
+}
+
+// parseDependencies returns the `project(":x")` dependencies declared in a build file.
+func parseDependencies(self, content string) []string {
+    seen := map[string]bool{}
+    var dependencies []string
+    for _, match := range projectDepRegexp.FindAllStringSubmatch(content, -1) {
+        path := match[1]
+        if path == self || seen[path] {
+            continue
+        }
+        seen[path] = true
+        dependencies = append(dependencies, path)
+    }
+    return dependencies
+}
+
+// LoadGraph reads settings.gradle(.kts) in rootDir and the build file of every included project.
+func LoadGraph(rootDir string) (*Graph, error) {
+    settings, found, err := readFirst(rootDir, settingsFiles)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read settings file: %s", err)
+    }
+    if !found {
+        return nil, fmt.Errorf("no settings.gradle(.kts) found in %s", rootDir)
+    }
+
+    graph := &Graph{
+        projects:   parseSettings(settings),
+        dependents: map[string][]string{},
+    }
+
+    for _, project := range graph.projects {
+        build, _, err := readFirst(filepath.Join(rootDir, project.Dir), buildFiles)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read build file of %s: %s", project.Path, err)
+        }
+        project.Dependencies = parseDependencies(project.Path, build)
+        for _, dependency := range project.Dependencies {
+            graph.dependents[dependency] = append(graph.dependents[dependency], project.Path)
+        }
+    }
+    return graph, nil
+}
+
+// ProjectForFile returns the project owning the file, i.e. the one with the deepest directory containing it.
+func (g *Graph) ProjectForFile(file string) (string, bool) {
+    file = filepath.ToSlash(filepath.Clean(file))
+    owner, ownerDir := "", ""
+    for _, project := range g.projects {
+        if !strings.HasPrefix(file, project.Dir + "/") {
+            continue
+        }
+        if len(project.Dir) > len(ownerDir) {
+            owner, ownerDir = project.Path, project.Dir
+        }
+    }
+    return owner, owner != ""
+}
+
+// Dependencies returns the direct project dependencies of a project.
+func (g *Graph) Dependencies(path string) []string {
+    if project, ok := g.projects[path]; ok {
+        return project.Dependencies
+    }
+    return nil
+}
+
+// Affected extends the set of changed modules with every project that transitively depends on one of them.
+func (g *Graph) Affected(changed map[string]bool) map[string]bool {
+    affected := map[string]bool{}
+    var queue []string
+    for module, isChanged := range changed {
+        if isChanged {
+            affected[module] = true
+            queue = append(queue, module)
+        }
+    }
+    sort.Strings(queue)
+
+    for len(queue) > 0 {
+        module := queue[0]
+        queue = queue[1:]
+        for _, dependent := range g.dependents[module] {
+            if affected[dependent] {
+                continue
+            }
+            log.Printf(" - [ %s ] depends on [ %s ]", dependent, module)
+            affected[dependent] = true
+            queue = append(queue, dependent)
+        }
+    }
+    return affected
+}
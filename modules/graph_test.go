@@ -0,0 +1,86 @@
+package modules
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+    dir, err := ioutil.TempDir("", "modules")
+    if err != nil {
+        t.Fatalf("setup: %s", err)
+    }
+    for name, content := range files {
+        pth := filepath.Join(dir, name)
+        if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+            t.Fatalf("setup: %s", err)
+        }
+        if err := ioutil.WriteFile(pth, []byte(content), 0644); err != nil {
+            t.Fatalf("setup: %s", err)
+        }
+    }
+    return dir
+}
+
+func TestParseSettings(t *testing.T) {
+    projects := parseSettings(stripComments(`
+include ':app', ':core'
+include(":libraries:design-system",
+        ":feature-login")
+// include ':disabled'
+project(':feature-login').projectDir = new File(rootDir, 'features/login')
+`))
+
+    require.Len(t, projects, 4)
+    require.Equal(t, "app", projects["app"].Dir)
+    require.Equal(t, "libraries/design-system", projects["libraries:design-system"].Dir)
+    require.Equal(t, "features/login", projects["feature-login"].Dir)
+}
+
+func TestGraph(t *testing.T) {
+    dir := writeFiles(t, map[string]string{
+        "settings.gradle.kts": `
+include(":app", ":core", ":design-system", ":feature-login", ":feature-cards")
+project(":feature-login").projectDir = file("features/login")
+project(":feature-cards").projectDir = file("features/cards")
+`,
+        "core/build.gradle.kts":          ``,
+        "design-system/build.gradle.kts": `dependencies { api(project(":core")) }`,
+        "features/login/build.gradle.kts": `dependencies { implementation(project(":design-system")) }`,
+        "features/cards/build.gradle.kts": `dependencies { implementation(project(path = ":core")) }`,
+        "app/build.gradle.kts": `
+dependencies {
+    implementation(project(":feature-login"))
+    implementation(project(":feature-cards"))
+}`,
+    })
+    defer os.RemoveAll(dir)
+
+    graph, err := LoadGraph(dir)
+    require.NoError(t, err)
+
+    module, ok := graph.ProjectForFile("features/login/src/main/Login.kt")
+    require.True(t, ok)
+    require.Equal(t, "feature-login", module)
+
+    _, ok = graph.ProjectForFile("gradle/libs.versions.toml")
+    require.False(t, ok)
+
+    require.Equal(t, map[string]bool{
+        "design-system": true,
+        "feature-login": true,
+        "app":           true,
+    }, graph.Affected(map[string]bool{"design-system": true}))
+
+    require.Equal(t, map[string]bool{
+        "core":          true,
+        "design-system": true,
+        "feature-login": true,
+        "feature-cards": true,
+        "app":           true,
+    }, graph.Affected(map[string]bool{"core": true}))
+}
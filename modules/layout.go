@@ -0,0 +1,183 @@
+package modules
+
+import (
+    "fmt"
+    "github.com/bitrise-io/go-steputils/stepconf"
+    "github.com/bitrise-io/go-utils/log"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/util"
+    "path"
+    "regexp"
+    "strings"
+)
+
+type LayoutConfig struct {
+    PathMapping    string    `env:"module_path_mapping"`
+}
+
+// mappingRule maps a directory pattern to a Gradle project path, e.g. `features/{name} => feature-{name}`.
+// Each pattern segment is either a `{var}` capturing one directory name, or a path.Match pattern.
+type mappingRule struct {
+    pattern    []string
+    project    string
+}
+
+// Layout resolves which module a file belongs to and where a module lives in the checkout.
+type Layout struct {
+    rules    []mappingRule
+    graph    *Graph
+}
+
+var placeholderRegexp = regexp.MustCompile(`\{(\w+)\}`)
+
+func parseMapping(mapping string) ([]mappingRule, error) {
+    var rules []mappingRule
+    for _, line := range strings.Split(mapping, "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        parts := strings.Split(line, "=>")
+        if len(parts) != 2 {
+            return nil, fmt.Errorf("invalid module path mapping (%s), expected `pattern => project`", line)
+        }
+        pattern := strings.Trim(strings.TrimSpace(parts[0]), "/")
+        project := strings.TrimPrefix(strings.TrimSpace(parts[1]), ":")
+        if pattern == "" || project == "" {
+            return nil, fmt.Errorf("invalid module path mapping (%s), expected `pattern => project`", line)
+        }
+
+        for _, match := range placeholderRegexp.FindAllStringSubmatch(project, -1) {
+            if !strings.Contains(pattern, match[0]) {
+                return nil, fmt.Errorf("invalid module path mapping (%s), %s is not captured by the pattern", line, match[0])
+            }
+        }
+
+        rules = append(rules, mappingRule{
+            pattern: strings.Split(pattern, "/"),
+            project: project,
+        })
+    }
+    return rules, nil
+}
+
+// match returns the project for a file located below the pattern's directory.
+func (r mappingRule) match(file string) (string, bool) {
+    segments := strings.Split(file, "/")
+    if len(segments) <= len(r.pattern) {
+        return "", false
+    }
+
+    vars := map[string]string{}
+    for i, segment := range r.pattern {
+        if match := placeholderRegexp.FindStringSubmatch(segment); match != nil && match[0] == segment {
+            vars[match[1]] = segments[i]
+            continue
+        }
+        if ok, _ := path.Match(segment, segments[i]); !ok {
+            return "", false
+        }
+    }
+
+    return placeholderRegexp.ReplaceAllStringFunc(r.project, func(placeholder string) string {
+        return vars[placeholder[1:len(placeholder) - 1]]
+    }), true
+}
+
+// dir returns the directory of a project matching the rule's project template.
+func (r mappingRule) dir(module string) (string, bool) {
+    var names []string
+    expr := "^"
+    last := 0
+    for _, loc := range placeholderRegexp.FindAllStringSubmatchIndex(r.project, -1) {
+        expr += regexp.QuoteMeta(r.project[last:loc[0]]) + `([^:/]+)`
+        names = append(names, r.project[loc[2]:loc[3]])
+        last = loc[1]
+    }
+    expr += regexp.QuoteMeta(r.project[last:]) + "$"
+    match := regexp.MustCompile(expr).FindStringSubmatch(module)
+    if match == nil {
+        return "", false
+    }
+
+    vars := map[string]string{}
+    for i, name := range names {
+        vars[name] = match[i + 1]
+    }
+
+    var segments []string
+    for _, segment := range r.pattern {
+        if placeholder := placeholderRegexp.FindStringSubmatch(segment); placeholder != nil && placeholder[0] == segment {
+            segment = vars[placeholder[1]]
+        } else if strings.ContainsAny(segment, "*?[") {
+            return "", false
+        }
+        segments = append(segments, segment)
+    }
+    return strings.Join(segments, "/"), true
+}
+
+func NewLayout(mapping string, graph *Graph) (*Layout, error) {
+    rules, err := parseMapping(mapping)
+    if err != nil {
+        return nil, err
+    }
+    return &Layout{rules: rules, graph: graph}, nil
+}
+
+// LoadLayout builds the layout of the project in the working directory from the step inputs.
+func LoadLayout() (*Layout, error) {
+    var cfg LayoutConfig
+    if err := stepconf.Parse(&cfg); err != nil {
+        return nil, util.ConfigErrorf("Issue with an input: %s", err)
+    }
+
+    graph, err := LoadGraph(".")
+    if err != nil {
+        log.Warnf("Failed to load the Gradle project graph: %s", err)
+    }
+
+    layout, err := NewLayout(cfg.PathMapping, graph)
+    if err != nil {
+        return nil, util.ConfigErrorf("Issue with an input: %s", err)
+    }
+    return layout, nil
+}
+
+// Graph returns the project dependency graph, nil if it could not be loaded.
+func (l *Layout) Graph() *Graph {
+    return l.graph
+}
+
+// ModuleForFile returns the module a file belongs to.
+// Mapping rules take precedence over the project directories declared in settings.gradle,
+// files outside of any known module are reported by their top level directory (e.g. `gradle`, `buildSrc`).
+func (l *Layout) ModuleForFile(file string) string {
+    for _, rule := range l.rules {
+        if module, ok := rule.match(file); ok {
+            return module
+        }
+    }
+    if l.graph != nil {
+        if module, ok := l.graph.ProjectForFile(file); ok {
+            return module
+        }
+    }
+    return strings.Split(file, "/")[0]
+}
+
+// DirForModule returns the directory of a module relative to the root project.
+func (l *Layout) DirForModule(module string) string {
+    module = strings.TrimPrefix(module, ":")
+    for _, rule := range l.rules {
+        if dir, ok := rule.dir(module); ok {
+            return dir
+        }
+    }
+    if l.graph != nil {
+        if project, ok := l.graph.projects[module]; ok {
+            return project.Dir
+        }
+    }
+    return strings.Replace(module, ":", "/", -1)
+}
@@ -0,0 +1,60 @@
+package modules
+
+import (
+    "testing"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestLayout(t *testing.T) {
+    layout, err := NewLayout(`
+# feature modules
+features/{name} => feature-{name}
+modules/feature/{name} => :feature:{name}
+libraries/{name} => libraries:{name}
+`, nil)
+    require.NoError(t, err)
+
+    tests := []struct {
+        file   string
+        module string
+        dir    string
+    }{
+        {file: "features/login/src/main/Login.kt", module: "feature-login", dir: "features/login"},
+        {file: "modules/feature/cards/build.gradle", module: "feature:cards", dir: "modules/feature/cards"},
+        {file: "libraries/design/src/main/Button.kt", module: "libraries:design", dir: "libraries/design"},
+        {file: "features/README.md", module: "features", dir: "features"},
+        {file: "gradle/libs.versions.toml", module: "gradle", dir: "gradle"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.file, func(t *testing.T) {
+            require.Equal(t, tt.module, layout.ModuleForFile(tt.file))
+            require.Equal(t, tt.dir, layout.DirForModule(tt.module))
+        })
+    }
+}
+
+func TestParseMapping_Invalid(t *testing.T) {
+    for _, mapping := range []string{
+        "features/{name}",
+        "features/{name} => ",
+        "features/* => feature-{name}",
+    } {
+        _, err := parseMapping(mapping)
+        require.Error(t, err, mapping)
+    }
+}
+
+func TestSelect(t *testing.T) {
+    graph := &Graph{projects: map[string]*Project{
+        "app":           {Path: "app", Dir: "app"},
+        "core":          {Path: "core", Dir: "core"},
+        "feature-login": {Path: "feature-login", Dir: "features/login"},
+        "feature-cards": {Path: "feature-cards", Dir: "features/cards"},
+    }}
+    layout, err := NewLayout("", graph)
+    require.NoError(t, err)
+
+    require.Equal(t, []string{"feature-cards", "feature-login", "core"}, layout.Select("feature-*\n:core\nfeature-login\n"))
+    require.Equal(t, "feature-login-debug-androidTest.apk", ArtifactName("{module}-debug-androidTest.apk", ":feature-login"))
+}
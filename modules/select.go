@@ -0,0 +1,58 @@
+package modules
+
+import (
+    "github.com/bitrise-io/go-utils/log"
+    "path"
+    "sort"
+    "strings"
+)
+
+// ArtifactName resolves the `{module}` placeholder of an artifact file name,
+// e.g. `{module}-debug.apk` is `feature-login-debug.apk` for the `feature-login` module.
+func ArtifactName(template, module string) string {
+    return strings.Replace(template, "{module}", strings.Replace(strings.TrimPrefix(module, ":"), ":", "-", -1), -1)
+}
+
+// Select returns the modules listed one per line in the selection.
+// Lines containing glob characters are matched against the projects declared in settings.gradle(.kts).
+func (l *Layout) Select(selection string) []string {
+    var projects []string
+    if l.graph != nil {
+        for project := range l.graph.projects {
+            projects = append(projects, project)
+        }
+        sort.Strings(projects)
+    }
+
+    seen := map[string]bool{}
+    var selected []string
+    add := func(module string) {
+        if !seen[module] {
+            seen[module] = true
+            selected = append(selected, module)
+        }
+    }
+
+    for _, line := range strings.Split(selection, "\n") {
+        line = strings.TrimPrefix(strings.TrimSpace(line), ":")
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        if !strings.ContainsAny(line, "*?[") {
+            add(line)
+            continue
+        }
+
+        matched := false
+        for _, project := range projects {
+            if ok, _ := path.Match(line, project); ok {
+                add(project)
+                matched = true
+            }
+        }
+        if !matched {
+            log.Warnf("No module matches %s", line)
+        }
+    }
+    return selected
+}
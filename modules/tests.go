@@ -0,0 +1,165 @@
+package modules
+
+import (
+    "github.com/bitrise-io/go-steputils/stepconf"
+    "github.com/bitrise-io/go-utils/command"
+    "github.com/bitrise-io/go-utils/log"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/util"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strings"
+)
+
+type TestDetectionConfig struct {
+    GradleFallback    bool    `env:"detect_tests_with_gradle"`
+}
+
+// TestDetection is the result of looking for instrumentation tests in a module.
+type TestDetection struct {
+    Module        string
+    HasTests      bool
+    Method        string
+    SourceSets    []string
+    Dirs          []string
+}
+
+var (
+    srcDirAssignRegexp = regexp.MustCompile(`(androidTest\w*)\s*\.\s*(?:java|kotlin)\s*\.\s*srcDirs?\b\s*(?:\+=|=|\()?\s*((?:\[|listOf\(|setOf\()?[^\n]*)`)
+    srcDirBlockRegexp  = regexp.MustCompile(`(androidTest\w*)\s*\{[^}]*?(?:java|kotlin)\s*\.\s*srcDirs?\b\s*(?:\+=|=|\()?\s*([^\n]*)`)
+    gradleSectionRegexp = regexp.MustCompile(`(?m)^(androidTest\w*)\n-+\n((?:.+\n?)*)`)
+    gradleSourcesRegexp = regexp.MustCompile(`(?m)^(?:Java|Kotlin) sources: \[(.*)\]`)
+)
+
+var testSourceExtensions = []string{".kt", ".java"}
+
+func containsTestSources(dir string) bool {
+    found := false
+    filepath.Walk(dir, func(pth string, info os.FileInfo, err error) error {
+        if err != nil || found {
+            return filepath.SkipDir
+        }
+        for _, ext := range testSourceExtensions {
+            if !info.IsDir() && strings.HasSuffix(info.Name(), ext) {
+                found = true
+                return filepath.SkipDir
+            }
+        }
+        return nil
+    })
+    return found
+}
+
+// customTestDirs returns the androidTest source directories configured in the module's build file, by source set.
+func customTestDirs(moduleDir string) map[string][]string {
+    build, _, err := readFirst(moduleDir, buildFiles)
+    if err != nil || build == "" {
+        return nil
+    }
+
+    dirs := map[string][]string{}
+    for _, re := range []*regexp.Regexp{srcDirAssignRegexp, srcDirBlockRegexp} {
+        for _, match := range re.FindAllStringSubmatch(build, -1) {
+            for _, quoted := range quotedPathRegexp.FindAllStringSubmatch(match[2], -1) {
+                dirs[match[1]] = append(dirs[match[1]], quoted[1])
+            }
+        }
+    }
+    return dirs
+}
+
+func (d *TestDetection) add(sourceSet, dir string) {
+    d.HasTests = true
+    d.Dirs = append(d.Dirs, dir)
+    for _, s := range d.SourceSets {
+        if s == sourceSet {
+            return
+        }
+    }
+    d.SourceSets = append(d.SourceSets, sourceSet)
+}
+
+// detectTestsOnDisk looks for test sources in every src/androidTest* source set and in the custom androidTest source directories.
+func detectTestsOnDisk(module, moduleDir string) TestDetection {
+    detection := TestDetection{Module: module, Method: "filesystem"}
+
+    sourceSetDirs, _ := filepath.Glob(filepath.Join(moduleDir, "src", "androidTest*"))
+    sort.Strings(sourceSetDirs)
+    for _, dir := range sourceSetDirs {
+        if containsTestSources(dir) {
+            detection.add(filepath.Base(dir), dir)
+        }
+    }
+
+    for sourceSet, dirs := range customTestDirs(moduleDir) {
+        for _, dir := range dirs {
+            dir = filepath.Join(moduleDir, dir)
+            if containsTestSources(dir) {
+                detection.add(sourceSet, dir)
+            }
+        }
+    }
+    return detection
+}
+
+// parseGradleSourceSets parses the androidTest* source directories from the output of the AGP `sourceSets` task.
+func parseGradleSourceSets(output string) map[string][]string {
+    dirs := map[string][]string{}
+    for _, section := range gradleSectionRegexp.FindAllStringSubmatch(output, -1) {
+        for _, sources := range gradleSourcesRegexp.FindAllStringSubmatch(section[2], -1) {
+            for _, dir := range strings.Split(sources[1], ",") {
+                if dir = strings.TrimSpace(dir); dir != "" {
+                    dirs[section[1]] = append(dirs[section[1]], dir)
+                }
+            }
+        }
+    }
+    return dirs
+}
+
+func detectTestsWithGradle(module, moduleDir string) (TestDetection, error) {
+    detection := TestDetection{Module: module, Method: "gradle"}
+
+    output, err := command.New("./gradlew", "-q", module + ":sourceSets").RunAndReturnTrimmedCombinedOutput()
+    if err != nil {
+        return detection, err
+    }
+
+    for sourceSet, dirs := range parseGradleSourceSets(output) {
+        for _, dir := range dirs {
+            if !filepath.IsAbs(dir) {
+                dir = filepath.Join(moduleDir, dir)
+            }
+            if containsTestSources(dir) {
+                detection.add(sourceSet, dir)
+            }
+        }
+    }
+    return detection, nil
+}
+
+// DetectTests reports whether the module has instrumentation test sources,
+// falling back to the Gradle source sets if enabled and none were found on disk.
+func (l *Layout) DetectTests(module string) (TestDetection, error) {
+    var cfg TestDetectionConfig
+    if err := stepconf.Parse(&cfg); err != nil {
+        return TestDetection{}, util.ConfigErrorf("Issue with an input: %s", err)
+    }
+
+    moduleDir := l.DirForModule(module)
+    detection := detectTestsOnDisk(module, moduleDir)
+    if !detection.HasTests && cfg.GradleFallback {
+        gradleDetection, err := detectTestsWithGradle(module, moduleDir)
+        if err != nil {
+            log.Warnf("Failed to list the source sets of %s with Gradle: %s", module, err)
+        } else {
+            detection = gradleDetection
+        }
+    }
+
+    log.Printf("module=%s has_tests=%t method=%s source_sets=%s dirs=%s",
+        detection.Module, detection.HasTests, detection.Method,
+        strings.Join(detection.SourceSets, ","), strings.Join(detection.Dirs, ","))
+    return detection, nil
+}
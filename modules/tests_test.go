@@ -0,0 +1,65 @@
+package modules
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestDetectTestsOnDisk(t *testing.T) {
+    dir := writeFiles(t, map[string]string{
+        "login/src/androidTestStaging/kotlin/LoginTest.kt": "",
+        "login/src/androidTest/res/values/strings.xml":     "",
+        "cards/src/androidTest/AndroidManifest.xml":        "",
+        "cards/build.gradle": `
+android {
+    sourceSets {
+        androidTest {
+            java.srcDirs += ['src/sharedTest/java']
+        }
+    }
+}`,
+        "cards/src/sharedTest/java/CardsTest.java": "",
+        "core/src/main/java/Core.kt":               "",
+    })
+    defer os.RemoveAll(dir)
+
+    login := detectTestsOnDisk("feature-login", filepath.Join(dir, "login"))
+    require.True(t, login.HasTests)
+    require.Equal(t, []string{"androidTestStaging"}, login.SourceSets)
+
+    cards := detectTestsOnDisk("feature-cards", filepath.Join(dir, "cards"))
+    require.True(t, cards.HasTests)
+    require.Equal(t, []string{"androidTest"}, cards.SourceSets)
+    require.Equal(t, []string{filepath.Join(dir, "cards", "src/sharedTest/java")}, cards.Dirs)
+
+    require.False(t, detectTestsOnDisk("core", filepath.Join(dir, "core")).HasTests)
+}
+
+func TestParseGradleSourceSets(t *testing.T) {
+    output := `------------------------------------------------------------
+Project ':feature-login'
+------------------------------------------------------------
+
+androidTest
+-----------
+Compile configuration: androidTestCompile
+build.gradle name: android.sourceSets.androidTest
+Java sources: [src/androidTest/java, src/sharedTest/java]
+Kotlin sources: [src/androidTest/kotlin]
+
+androidTestStaging
+------------------
+Java sources: [src/androidTestStaging/java]
+
+main
+----
+Java sources: [src/main/java]
+`
+    require.Equal(t, map[string][]string{
+        "androidTest":        {"src/androidTest/java", "src/sharedTest/java", "src/androidTest/kotlin"},
+        "androidTestStaging": {"src/androidTestStaging/java"},
+    }, parseGradleSourceSets(output))
+}
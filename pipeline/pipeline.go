@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+    "encoding/json"
+    "fmt"
+    "github.com/bitrise-io/go-utils/log"
+    "io"
+    "io/ioutil"
+    "strings"
+    "text/tabwriter"
+    "time"
+)
+
+const (
+    StatusDone       = "done"
+    StatusSkipped    = "skipped"
+    StatusFailed     = "failed"
+    StatusNotRun     = "not run"
+)
+
+// Stage is a named step of the pipeline.
+type Stage struct {
+    Name    string
+    // Skip returns whether the stage should be skipped, and why. The stage always runs if nil.
+    Skip    func() (bool, string)
+    Run     func() error
+}
+
+// Timing is the outcome of a stage.
+type Timing struct {
+    Name        string           `json:"name"`
+    Status      string           `json:"status"`
+    Reason      string           `json:"reason,omitempty"`
+    Duration    time.Duration    `json:"-"`
+    Millis      int64            `json:"duration_ms"`
+}
+
+// Pipeline runs its stages in order, stopping at the first failure, and records how long each took.
+type Pipeline struct {
+    stages     []Stage
+    timings    []Timing
+    now        func() time.Time
+}
+
+func New() *Pipeline {
+    return &Pipeline{now: time.Now}
+}
+
+func (p *Pipeline) Add(stage Stage) {
+    p.stages = append(p.stages, stage)
+}
+
+// maxReasonLength keeps the timings small enough to export, errors of commands include their whole stderr.
+const maxReasonLength = 200
+
+// failureReason returns the first line of the error, truncated to maxReasonLength characters.
+func failureReason(err error) string {
+    reason := strings.TrimSpace(err.Error())
+    if i := strings.IndexAny(reason, "\r\n"); i >= 0 {
+        reason = strings.TrimSpace(reason[:i])
+    }
+    if runes := []rune(reason); len(runes) > maxReasonLength {
+        reason = string(runes[:maxReasonLength - 1]) + "…"
+    }
+    return reason
+}
+
+func (p *Pipeline) record(stage Stage, status, reason string, duration time.Duration) {
+    p.timings = append(p.timings, Timing{
+        Name:     stage.Name,
+        Status:   status,
+        Reason:   reason,
+        Duration: duration,
+        Millis:   int64(duration / time.Millisecond),
+    })
+}
+
+// Run runs the stages and returns the error of the failed stage, if any.
+func (p *Pipeline) Run() error {
+    p.timings = nil
+    for i, stage := range p.stages {
+        if stage.Skip != nil {
+            if skip, reason := stage.Skip(); skip {
+                log.Infof("=== Skipping %s: %s ===", stage.Name, reason)
+                p.record(stage, StatusSkipped, reason, 0)
+                continue
+            }
+        }
+
+        log.Infof("=== %s ===", stage.Name)
+        start := p.now()
+        err := stage.Run()
+        duration := p.now().Sub(start)
+        if err != nil {
+            p.record(stage, StatusFailed, failureReason(err), duration)
+            for _, notRun := range p.stages[i + 1:] {
+                p.record(notRun, StatusNotRun, "", 0)
+            }
+            return err
+        }
+        p.record(stage, StatusDone, "", duration)
+    }
+    return nil
+}
+
+// Timings returns the outcome of every stage of the last run.
+func (p *Pipeline) Timings() []Timing {
+    return p.timings
+}
+
+// Total returns the summed duration of the stages.
+func (p *Pipeline) Total() time.Duration {
+    var total time.Duration
+    for _, timing := range p.timings {
+        total += timing.Duration
+    }
+    return total
+}
+
+// PrintSummary writes a table of the stages, their status and duration.
+func (p *Pipeline) PrintSummary(out io.Writer) {
+    w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "Stage\tStatus\tDuration")
+    for _, timing := range p.timings {
+        fmt.Fprintf(w, "%s\t%s\t%s\n", timing.Name, timing.Status, timing.Duration.Round(time.Millisecond))
+    }
+    fmt.Fprintf(w, "total\t\t%s\n", p.Total().Round(time.Millisecond))
+    w.Flush()
+}
+
+// JSON returns the timings as a JSON array.
+func (p *Pipeline) JSON() (string, error) {
+    timings := p.timings
+    if timings == nil {
+        timings = []Timing{}
+    }
+    b, err := json.Marshal(timings)
+    if err != nil {
+        return "", err
+    }
+    return string(b), nil
+}
+
+// WriteJSON writes the timings as a JSON array to the file.
+func (p *Pipeline) WriteJSON(pth string) error {
+    value, err := p.JSON()
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(pth, []byte(value), 0644)
+}
@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+    "bytes"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestPipeline_Run(t *testing.T) {
+    clock := time.Unix(0, 0)
+    p := New()
+    p.now = func() time.Time {
+        clock = clock.Add(250 * time.Millisecond)
+        return clock
+    }
+
+    var ran []string
+    p.Add(Stage{Name: "assemble", Run: func() error {
+        ran = append(ran, "assemble")
+        return nil
+    }})
+    p.Add(Stage{Name: "deploy", Skip: func() (bool, string) { return true, "dry run" }, Run: func() error {
+        ran = append(ran, "deploy")
+        return nil
+    }})
+    p.Add(Stage{Name: "trigger", Run: func() error {
+        ran = append(ran, "trigger")
+        return errors.New("no access")
+    }})
+    p.Add(Stage{Name: "report", Run: func() error {
+        ran = append(ran, "report")
+        return nil
+    }})
+
+    require.EqualError(t, p.Run(), "no access")
+    require.Equal(t, []string{"assemble", "trigger"}, ran)
+    require.Equal(t, 500*time.Millisecond, p.Total())
+
+    value, err := p.JSON()
+    require.NoError(t, err)
+    require.Equal(t, `[{"name":"assemble","status":"done","duration_ms":250},`+
+        `{"name":"deploy","status":"skipped","reason":"dry run","duration_ms":0},`+
+        `{"name":"trigger","status":"failed","reason":"no access","duration_ms":250},`+
+        `{"name":"report","status":"not run","duration_ms":0}]`, value)
+
+    var summary bytes.Buffer
+    p.PrintSummary(&summary)
+    require.Equal(t, `Stage     Status   Duration
+assemble  done     250ms
+deploy    skipped  0s
+trigger   failed   250ms
+report    not run  0s
+total              500ms
+`, summary.String())
+}
+
+func TestFailureReason(t *testing.T) {
+    require.Equal(t, "exit status 1", failureReason(errors.New("exit status 1\nFAILURE: Build failed with an exception.\n* What went wrong:")))
+    reason := failureReason(errors.New(strings.Repeat("x", 500)))
+    require.Equal(t, maxReasonLength, len([]rune(reason)))
+    require.True(t, strings.HasSuffix(reason, "…"))
+}
@@ -0,0 +1,137 @@
+package plan
+
+import (
+    "encoding/json"
+    "fmt"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/deploy"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/env"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gh"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gradle"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/modules"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/trigger"
+    "io"
+    "strings"
+)
+
+// Module is what is done with a selected module.
+type Module struct {
+    Name           string                `json:"name"`
+    Outputs        gradle.OutputsPlan    `json:"outputs"`
+    Environment    []env.Variable        `json:"environment"`
+    // Shards are the environments of the runs the tests are split into, Environment is the first one's.
+    Shards         [][]env.Variable      `json:"shards,omitempty"`
+}
+
+// Plan is what the step would build, deploy and trigger.
+type Plan struct {
+    Modules        []Module                  `json:"modules"`
+    Build          *gradle.BuildPlan         `json:"build,omitempty"`
+    DeployFiles    []string                  `json:"deploy_files"`
+    Builds         []trigger.PlannedBuild    `json:"builds"`
+}
+
+// Resolve returns the plan of building the modules, without running Gradle, uploading or calling the Bitrise API.
+func Resolve(layout *modules.Layout, moduleList []string) (Plan, error) {
+    plan := Plan{Modules: []Module{}, DeployFiles: []string{}, Builds: []trigger.PlannedBuild{}}
+    if len(moduleList) == 0 {
+        return plan, nil
+    }
+
+    build, err := gradle.PlanBuild(moduleList)
+    if err != nil {
+        return Plan{}, err
+    }
+    plan.Build = &build
+
+    var pending []string
+    var valueSets []map[string]string
+    for _, module := range moduleList {
+        outputs, err := gradle.PlanOutputs(layout, module)
+        if err != nil {
+            return Plan{}, err
+        }
+        shards, err := env.PlanTargetEnvs(outputs.Found, outputs.Outputs)
+        if err != nil {
+            return Plan{}, err
+        }
+        planned := Module{Name: module, Outputs: outputs, Environment: shards[0]}
+        if len(shards) > 1 {
+            planned.Shards = shards
+        }
+        plan.Modules = append(plan.Modules, planned)
+
+        for _, apk := range []string{outputs.Outputs.AppAPK, outputs.Outputs.TestAPK, outputs.Outputs.TargetAPK} {
+            if apk != "" {
+                pending = append(pending, apk)
+            }
+        }
+        for _, variables := range shards {
+            values := env.Values(module, variables)
+            for key, value := range gh.StatusEnv(module) {
+                values[key] = value
+            }
+            valueSets = append(valueSets, values)
+        }
+    }
+
+    if plan.DeployFiles, err = deploy.PlanFiles(pending); err != nil {
+        return Plan{}, err
+    }
+    if plan.Builds, err = trigger.PlanBuilds(valueSets); err != nil {
+        return Plan{}, err
+    }
+    return plan, nil
+}
+
+// Print writes the plan in a human readable form.
+func (p Plan) Print(out io.Writer) {
+    if len(p.Modules) == 0 {
+        fmt.Fprintln(out, "Nothing to build")
+        return
+    }
+
+    fmt.Fprintln(out, "Gradle:")
+    fmt.Fprintf(out, "  %s\n", strings.Join(p.Build.Command, " "))
+    if p.Build.GradleOpts != "" {
+        fmt.Fprintf(out, "  GRADLE_OPTS=%s\n", p.Build.GradleOpts)
+    }
+
+    for _, module := range p.Modules {
+        fmt.Fprintf(out, "Module %s:\n", module.Name)
+        fmt.Fprintf(out, "  APKs collected from %s into %s\n", module.Outputs.APKDir, module.Outputs.DeployDir)
+        if len(module.Shards) == 0 {
+            for _, variable := range module.Environment {
+                fmt.Fprintf(out, "  %s=%s\n", variable.Key, variable.Value)
+            }
+        }
+        for i, shard := range module.Shards {
+            fmt.Fprintf(out, "  Shard %d/%d:\n", i + 1, len(module.Shards))
+            for _, variable := range shard {
+                fmt.Fprintf(out, "    %s=%s\n", variable.Key, variable.Value)
+            }
+        }
+    }
+
+    fmt.Fprintln(out, "Deployed files:")
+    for _, file := range p.DeployFiles {
+        fmt.Fprintf(out, "  %s\n", file)
+    }
+
+    fmt.Fprintln(out, "Started workflows:")
+    for _, build := range p.Builds {
+        var values []string
+        for _, environment := range build.Environments {
+            values = append(values, fmt.Sprintf("%s=%s", environment.MappedTo, environment.Value))
+        }
+        fmt.Fprintf(out, "  %s (%s)\n", build.Workflow, strings.Join(values, ", "))
+    }
+}
+
+// JSON returns the plan as a JSON object.
+func (p Plan) JSON() (string, error) {
+    b, err := json.Marshal(p)
+    if err != nil {
+        return "", err
+    }
+    return string(b), nil
+}
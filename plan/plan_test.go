@@ -0,0 +1,145 @@
+package plan
+
+import (
+    "bytes"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/bitrise"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/env"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/gradle"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/modules"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/trigger"
+    "github.com/stretchr/testify/require"
+)
+
+func TestPlan_Print(t *testing.T) {
+    var empty bytes.Buffer
+    Plan{}.Print(&empty)
+    require.Equal(t, "Nothing to build\n", empty.String())
+
+    p := Plan{
+        Modules: []Module{{
+            Name: "feature-login",
+            Outputs: gradle.OutputsPlan{
+                APKDir:    "features/login/build/outputs/apk",
+                DeployDir: "/deploy",
+                Outputs:   gradle.Outputs{TargetAPK: "/deploy/feature-login-debug.apk"},
+            },
+            Environment: []env.Variable{
+                {Key: "ADB_COMMAND", Value: `"adb shell am instrument -r -w  com.example.test/androidx.test.runner.AndroidJUnitRunner"`},
+                {Key: "TARGET_APK", Value: "feature-login-debug.apk"},
+            },
+        }},
+        Build:       &gradle.BuildPlan{Command: []string{"./gradlew", "feature-login:assembleDebug"}},
+        DeployFiles: []string{"/deploy/feature-login-debug.apk"},
+        Builds: []trigger.PlannedBuild{{
+            Workflow:     "test",
+            Environments: []bitrise.Environment{{MappedTo: "TARGET_APK", Value: "feature-login-debug.apk"}},
+        }},
+    }
+
+    var out bytes.Buffer
+    p.Print(&out)
+    require.Equal(t, `Gradle:
+  ./gradlew feature-login:assembleDebug
+Module feature-login:
+  APKs collected from features/login/build/outputs/apk into /deploy
+  ADB_COMMAND="adb shell am instrument -r -w  com.example.test/androidx.test.runner.AndroidJUnitRunner"
+  TARGET_APK=feature-login-debug.apk
+Deployed files:
+  /deploy/feature-login-debug.apk
+Started workflows:
+  test (TARGET_APK=feature-login-debug.apk)
+`, out.String())
+
+    value, err := p.JSON()
+    require.NoError(t, err)
+    require.Contains(t, value, `"build":{"command":["./gradlew","feature-login:assembleDebug"]}`)
+    require.Contains(t, value, `"builds":[{"workflow":"test","environments":[{"mapped_to":"TARGET_APK","value":"feature-login-debug.apk"}]}]`)
+}
+
+func TestPlan_PrintShards(t *testing.T) {
+    shards := [][]env.Variable{
+        {{Key: "ADB_COMMAND", Value: `"adb shell am instrument -r -w -e numShards 2 -e shardIndex 0 com.example.test/androidx.test.runner.AndroidJUnitRunner"`}},
+        {{Key: "ADB_COMMAND", Value: `"adb shell am instrument -r -w -e numShards 2 -e shardIndex 1 com.example.test/androidx.test.runner.AndroidJUnitRunner"`}},
+    }
+    p := Plan{
+        Modules: []Module{{
+            Name:        "feature-login",
+            Outputs:     gradle.OutputsPlan{APKDir: "features/login/build/outputs/apk", DeployDir: "/deploy"},
+            Environment: shards[0],
+            Shards:      shards,
+        }},
+        Build: &gradle.BuildPlan{Command: []string{"./gradlew", "feature-login:assembleDebug"}},
+    }
+
+    var out bytes.Buffer
+    p.Print(&out)
+    require.Equal(t, `Gradle:
+  ./gradlew feature-login:assembleDebug
+Module feature-login:
+  APKs collected from features/login/build/outputs/apk into /deploy
+  Shard 1/2:
+    ADB_COMMAND="adb shell am instrument -r -w -e numShards 2 -e shardIndex 0 com.example.test/androidx.test.runner.AndroidJUnitRunner"
+  Shard 2/2:
+    ADB_COMMAND="adb shell am instrument -r -w -e numShards 2 -e shardIndex 1 com.example.test/androidx.test.runner.AndroidJUnitRunner"
+Deployed files:
+Started workflows:
+`, out.String())
+}
+
+func TestResolve_TestPackageFromTestAPK(t *testing.T) {
+    dir, err := ioutil.TempDir("", "plan")
+    require.NoError(t, err)
+    defer os.RemoveAll(dir)
+    wd, err := os.Getwd()
+    require.NoError(t, err)
+    require.NoError(t, os.Chdir(dir))
+    defer os.Chdir(wd)
+
+    // Built by a previous build, but not deployed: a dry run doesn't copy the APKs.
+    testAPK := "feature-login/build/outputs/apk/androidTest/debug/feature-login-debug-androidTest.apk"
+    require.NoError(t, os.MkdirAll(filepath.Dir(testAPK), 0755))
+    require.NoError(t, ioutil.WriteFile(testAPK, []byte("not an APK"), 0644))
+    deployDir := filepath.Join(dir, "deploy")
+    require.NoError(t, os.MkdirAll(deployDir, 0755))
+
+    for key, value := range map[string]string{
+        "variant":                            "Debug",
+        "deploy_path":                        deployDir,
+        "build_test_apk":                     "true",
+        "test_package":                       "",
+        "test_runner":                        "",
+        "is_junit_5":                         "false",
+        "is_compress":                        "false",
+        "is_enable_public_page":              "false",
+        "build_url":                          "https://app.bitrise.io",
+        "build_api_token":                    "token",
+        "public_install_page_url_map_format": "{{range}}",
+        "permanent_download_url_map_format":  "{{range}}",
+        "BITRISE_BUILD_SLUG":                 "build",
+        "BITRISE_BUILD_NUMBER":               "1",
+        "BITRISE_TEST_DEPLOY_DIR":            deployDir,
+        "BITRISE_APP_SLUG":                   "app",
+        "addon_api_base_url":                 "https://addon",
+        "verbose":                            "false",
+        "bundletool_version":                 "1.8.0",
+        "access_token":                       "token",
+        "workflows":                          "test",
+        "environment_key_list":               "$ADB_COMMAND",
+    } {
+        t.Setenv(key, value)
+    }
+
+    layout, err := modules.NewLayout("", nil)
+    require.NoError(t, err)
+    resolved, err := Resolve(layout, []string{"feature-login"})
+    require.NoError(t, err)
+    require.Len(t, resolved.Modules, 1)
+    require.Equal(t, "ADB_COMMAND", resolved.Modules[0].Environment[0].Key)
+    require.Contains(t, resolved.Modules[0].Environment[0].Value, "<read from test APK>")
+    require.Equal(t, testAPK, resolved.Modules[0].Outputs.Found.TestAPK)
+}
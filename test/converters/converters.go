@@ -6,6 +6,7 @@
 package converters
 
 import (
+	"github.com/bitrise-steplib/bitrise-step-build-router-start/test/converters/instrumentation"
 	"github.com/bitrise-steplib/bitrise-step-build-router-start/test/converters/junitxml"
 	"github.com/bitrise-steplib/bitrise-step-build-router-start/test/converters/xcresult"
 	"github.com/bitrise-steplib/bitrise-step-build-router-start/test/converters/xcresult3"
@@ -22,6 +23,7 @@ var converters = []Intf{
 	&junitxml.Converter{},
 	&xcresult.Converter{},
 	&xcresult3.Converter{},
+	&instrumentation.Converter{},
 }
 
 // List lists all supported converters
@@ -0,0 +1,227 @@
+// Package instrumentation converts the raw output of `am instrument -r` to JUnit XML.
+package instrumentation
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-steplib/bitrise-step-build-router-start/test/junit"
+)
+
+// Status codes of a test, reported in INSTRUMENTATION_STATUS_CODE.
+const (
+	statusStart             = 1
+	statusOK                = 0
+	statusError             = -1
+	statusFailure           = -2
+	statusIgnored           = -3
+	statusAssumptionFailure = -4
+)
+
+const (
+	statusPrefix     = "INSTRUMENTATION_STATUS: "
+	statusCodePrefix = "INSTRUMENTATION_STATUS_CODE: "
+	resultPrefix     = "INSTRUMENTATION_RESULT: "
+	codePrefix       = "INSTRUMENTATION_CODE: "
+	// detectPrefix is what raw instrumentation output starts with, read from the beginning of the files.
+	detectPrefix = "INSTRUMENTATION_"
+	detectSize   = 4096
+)
+
+var timeRegexp = regexp.MustCompile(`(?m)^Time: ([0-9.,]+)`)
+
+// Converter holds data of the converter
+type Converter struct {
+	files []string
+}
+
+// Detect return true if the test results contain raw instrumentation output
+func (h *Converter) Detect(files []string) bool {
+	h.files = nil
+	for _, file := range files {
+		if isRawOutput(file) {
+			h.files = append(h.files, file)
+		}
+	}
+	return len(h.files) > 0
+}
+
+func isRawOutput(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	head := make([]byte, detectSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(head[:n]), []byte(detectPrefix))
+}
+
+// parser collects the key-value pairs of the status blocks, a value lasts until the next INSTRUMENTATION_ line.
+type parser struct {
+	suites  []junit.TestSuite
+	bundle  map[string]string
+	key     string
+	result  map[string]string
+	running *junit.TestCase
+}
+
+func (p *parser) suite(class string) *junit.TestSuite {
+	for i := range p.suites {
+		if p.suites[i].Name == class {
+			return &p.suites[i]
+		}
+	}
+	p.suites = append(p.suites, junit.TestSuite{Name: class})
+	return &p.suites[len(p.suites)-1]
+}
+
+func firstLine(s string) string {
+	return strings.TrimSpace(strings.SplitN(strings.TrimSpace(s), "\n", 2)[0])
+}
+
+// finish records the test of the status block with its outcome.
+func (p *parser) finish(code int) {
+	bundle := p.bundle
+	p.bundle = map[string]string{}
+
+	testCase := junit.TestCase{Name: bundle["test"], ClassName: bundle["class"]}
+	if code == statusStart {
+		p.running = &testCase
+		return
+	}
+	p.running = nil
+	if testCase.Name == "" {
+		return
+	}
+
+	suite := p.suite(testCase.ClassName)
+	stack := strings.TrimSpace(bundle["stack"])
+	switch code {
+	case statusFailure:
+		testCase.Failure = &junit.Failure{Message: firstLine(stack), Value: stack}
+		suite.Failures++
+	case statusError:
+		testCase.Error = &junit.Error{Message: firstLine(stack), Value: stack}
+		suite.Errors++
+	case statusIgnored:
+		testCase.Skipped = &junit.Skipped{}
+	case statusAssumptionFailure:
+		testCase.Skipped = &junit.Skipped{Message: firstLine(stack)}
+	}
+	suite.Tests++
+	suite.TestCases = append(suite.TestCases, testCase)
+}
+
+// crash records the test running when the instrumentation stopped, e.g. because the app crashed.
+func (p *parser) crash() {
+	if p.running == nil {
+		return
+	}
+	testCase := *p.running
+	message := p.result["shortMsg"]
+	if message == "" {
+		message = "Test did not finish"
+	}
+	testCase.Failure = &junit.Failure{Message: message, Value: strings.TrimSpace(p.result["longMsg"] + "\n" + p.result["stream"])}
+
+	suite := p.suite(testCase.ClassName)
+	suite.Failures++
+	suite.Tests++
+	suite.TestCases = append(suite.TestCases, testCase)
+	p.running = nil
+}
+
+func (p *parser) line(line string) error {
+	switch {
+	case strings.HasPrefix(line, statusPrefix):
+		p.key, p.bundle = setValue(p.bundle, strings.TrimPrefix(line, statusPrefix))
+	case strings.HasPrefix(line, resultPrefix):
+		p.key, p.result = setValue(p.result, strings.TrimPrefix(line, resultPrefix))
+		p.bundle = nil
+	case strings.HasPrefix(line, statusCodePrefix):
+		code, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, statusCodePrefix)))
+		if err != nil {
+			return err
+		}
+		p.finish(code)
+		p.key = ""
+	case strings.HasPrefix(line, codePrefix):
+		p.crash()
+		p.key = ""
+	case p.key != "" && p.bundle != nil:
+		p.bundle[p.key] += "\n" + line
+	case p.key != "" && p.result != nil:
+		p.result[p.key] += "\n" + line
+	}
+	return nil
+}
+
+func setValue(values map[string]string, keyValue string) (string, map[string]string) {
+	if values == nil {
+		values = map[string]string{}
+	}
+	parts := strings.SplitN(keyValue, "=", 2)
+	if len(parts) != 2 {
+		return "", values
+	}
+	values[parts[0]] = parts[1]
+	return parts[0], values
+}
+
+// parse converts raw instrumentation output to test suites, one per test class.
+// Tests have no duration in the raw output, only the whole run has, which is attributed to the suites by their test count.
+func parse(output string) ([]junit.TestSuite, error) {
+	p := parser{bundle: map[string]string{}}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if err := p.line(strings.TrimRight(scanner.Text(), "\r")); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	p.crash()
+
+	if match := timeRegexp.FindStringSubmatch(p.result["stream"]); match != nil {
+		if total, err := strconv.ParseFloat(strings.Replace(match[1], ",", "", -1), 64); err == nil {
+			tests := 0
+			for _, suite := range p.suites {
+				tests += suite.Tests
+			}
+			for i := range p.suites {
+				p.suites[i].Time = total * float64(p.suites[i].Tests) / float64(tests)
+			}
+		}
+	}
+	return p.suites, nil
+}
+
+// XML returns the xml content bytes
+func (h *Converter) XML() (junit.XML, error) {
+	var xmlContent junit.XML
+	for _, file := range h.files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return junit.XML{}, err
+		}
+		suites, err := parse(string(content))
+		if err != nil {
+			return junit.XML{}, err
+		}
+		xmlContent.TestSuites = append(xmlContent.TestSuites, suites...)
+	}
+	return xmlContent, nil
+}
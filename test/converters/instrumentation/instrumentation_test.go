@@ -0,0 +1,101 @@
+package instrumentation
+
+import (
+	"testing"
+
+	"github.com/bitrise-steplib/bitrise-step-build-router-start/test/junit"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConverter(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  junit.XML
+	}{
+		{
+			name:  "failed, errored, ignored and assumption failure tests",
+			files: []string{"./testdata/raw_output.txt"},
+			want: junit.XML{TestSuites: []junit.TestSuite{
+				{
+					Name:     "com.example.LoginTest",
+					Tests:    3,
+					Failures: 1,
+					Time:     1.5,
+					TestCases: []junit.TestCase{
+						{Name: "validPassword", ClassName: "com.example.LoginTest"},
+						{
+							Name:      "invalidPassword",
+							ClassName: "com.example.LoginTest",
+							Failure: &junit.Failure{
+								Message: "java.lang.AssertionError: expected:<false> but was:<true>",
+								Value: "java.lang.AssertionError: expected:<false> but was:<true>\n" +
+									"\tat org.junit.Assert.fail(Assert.java:89)\n" +
+									"\tat com.example.LoginTest.invalidPassword(LoginTest.kt:31)",
+							},
+						},
+						{
+							Name:      "biometrics",
+							ClassName: "com.example.LoginTest",
+							Skipped:   &junit.Skipped{Message: "org.junit.AssumptionViolatedException: no fingerprint sensor"},
+						},
+					},
+				},
+				{
+					Name:   "com.example.CardsTest",
+					Tests:  3,
+					Errors: 1,
+					Time:   1.5,
+					TestCases: []junit.TestCase{
+						{Name: "freezeCard", ClassName: "com.example.CardsTest", Skipped: &junit.Skipped{}},
+						{Name: "listCards", ClassName: "com.example.CardsTest"},
+						{
+							Name:      "cardDetails",
+							ClassName: "com.example.CardsTest",
+							Error: &junit.Error{
+								Message: "java.lang.IllegalStateException: no card",
+								Value: "java.lang.IllegalStateException: no card\n" +
+									"\tat com.example.CardsTest.cardDetails(CardsTest.kt:42)",
+							},
+						},
+					},
+				},
+			}},
+		},
+		{
+			name:  "crashed test",
+			files: []string{"./testdata/crash.txt"},
+			want: junit.XML{TestSuites: []junit.TestSuite{
+				{
+					Name:     "com.example.CardsTest",
+					Tests:    1,
+					Failures: 1,
+					TestCases: []junit.TestCase{
+						{Name: "freezeCard", ClassName: "com.example.CardsTest", Failure: &junit.Failure{Message: "Process crashed."}},
+					},
+				},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converter := &Converter{}
+			if !converter.Detect(append([]string{"./instrumentation.go"}, tt.files...)) {
+				t.Fatalf("Detect() = false")
+			}
+			got, err := converter.XML()
+			if err != nil {
+				t.Fatalf("XML() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("XML() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConverter_Detect(t *testing.T) {
+	if (&Converter{}).Detect([]string{"./instrumentation.go", "./testdata/missing.txt"}) {
+		t.Errorf("Detect() = true for files without instrumentation output")
+	}
+}
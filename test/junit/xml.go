@@ -29,6 +29,7 @@ type TestCase struct {
 	Time      float64  `xml:"time,attr"`
 	Failure   *Failure `xml:"failure,omitempty"`
 	Error     *Error   `xml:"error,omitempty"`
+	Skipped   *Skipped `xml:"skipped,omitempty"`
 	SystemErr string   `xml:"system-err,omitempty"`
 }
 
@@ -45,3 +46,9 @@ type Error struct {
 	Message string   `xml:"message,attr,omitempty"`
 	Value   string   `xml:",chardata"`
 }
+
+// Skipped ...
+type Skipped struct {
+	XMLName xml.Name `xml:"skipped,omitempty"`
+	Message string   `xml:"message,attr,omitempty"`
+}
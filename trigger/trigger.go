@@ -1,19 +1,24 @@
 package trigger
 
 import (
+    "encoding/json"
     "fmt"
+    "io"
     "os"
     "path/filepath"
     "strings"
 
     "github.com/bitrise-io/go-steputils/stepconf"
-    "github.com/bitrise-io/go-steputils/tools"
     "github.com/bitrise-io/go-utils/log"
     "github.com/bitrise-steplib/bitrise-step-build-router-start/bitrise"
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/execmd"
     "github.com/bitrise-steplib/bitrise-step-build-router-start/util"
 )
 
-const envBuildSlugs = "ROUTER_STARTED_BUILD_SLUGS"
+const (
+    envBuildSlugs   = "ROUTER_STARTED_BUILD_SLUGS"
+    envBuildResults = "BUILD_MODULE_BUILD_RESULTS"
+)
 
 // Config ...
 type Config struct {
@@ -29,10 +34,166 @@ type Config struct {
     IsVerboseLog           bool            `env:"verbose,required"`
 }
 
-func TriggerWorkflow() {
+func parseConfig() (Config, error) {
     var cfg Config
     if err := stepconf.Parse(&cfg); err != nil {
-        util.Failf("Issue with an input: %s", err)
+        return Config{}, util.ConfigErrorf("Issue with an input: %s", err)
+    }
+    return cfg, nil
+}
+
+// SharedEnvironments returns the current values of the environments to share with the started builds.
+func SharedEnvironments() ([]bitrise.Environment, error) {
+    return SharedEnvironmentsWith(nil)
+}
+
+// SharedEnvironmentsWith returns the environments to share with the started builds,
+// the given values take precedence over the current ones.
+func SharedEnvironmentsWith(values map[string]string) ([]bitrise.Environment, error) {
+    cfg, err := parseConfig()
+    if err != nil {
+        return nil, err
+    }
+    return createEnvs(cfg.Environments, lookupIn(values)), nil
+}
+
+func lookupIn(values map[string]string) func(string) string {
+    return func(key string) string {
+        if value, ok := values[key]; ok {
+            return value
+        }
+        return os.Getenv(key)
+    }
+}
+
+// Group is an environment set the workflows are started with, e.g. a module or one of its shards.
+type Group struct {
+    Name            string
+    Module          string
+    Environments    []bitrise.Environment
+}
+
+// Result is the outcome of a started build.
+type Result struct {
+    Group        string    `json:"group"`
+    Module       string    `json:"module,omitempty"`
+    Workflow     string    `json:"workflow"`
+    BuildSlug    string    `json:"build_slug"`
+    Status       string    `json:"status"`
+}
+
+const (
+    statusRunning    = "running"
+    statusSuccessful = "successful"
+)
+
+// resultStatus returns the status of a finished build.
+func resultStatus(build bitrise.Build) string {
+    switch build.Status {
+    case 1:
+        return statusSuccessful
+    case 2:
+        return "failed"
+    case 3:
+        return "aborted"
+    case 4:
+        return "cancelled"
+    }
+    return statusRunning
+}
+
+// printResults writes the results in the order the builds were started.
+func printResults(out io.Writer, results []Result) {
+    for _, result := range results {
+        name := result.Workflow
+        if result.Group != "" {
+            name = fmt.Sprintf("%s: %s", result.Group, result.Workflow)
+        }
+        fmt.Fprintf(out, "- %s %s\n", name, result.Status)
+    }
+}
+
+// ModuleOutcome summarizes the builds of the module, across its shards and workflows.
+// finished is false if any of them is still running, e.g. because they were not waited for.
+func ModuleOutcome(results []Result, module string) (finished bool, unsuccessful, total int) {
+    finished = true
+    for _, result := range results {
+        if result.Module != module {
+            continue
+        }
+        total++
+        switch result.Status {
+        case statusRunning:
+            finished = false
+        case statusSuccessful:
+        default:
+            unsuccessful++
+        }
+    }
+    return finished && total > 0, unsuccessful, total
+}
+
+// unsuccessfulResults returns the results of the builds which did not succeed.
+func unsuccessfulResults(results []Result) []Result {
+    var unsuccessful []Result
+    for _, result := range results {
+        if result.Status != statusSuccessful {
+            unsuccessful = append(unsuccessful, result)
+        }
+    }
+    return unsuccessful
+}
+
+// PlannedBuild is a build TriggerWorkflows starts.
+type PlannedBuild struct {
+    Workflow        string                   `json:"workflow"`
+    Environments    []bitrise.Environment    `json:"environments"`
+}
+
+// PlanBuilds returns the builds TriggerWorkflows starts for every set of environment values, without calling the Bitrise API.
+// The values are the ones to share which are not yet set in the environment, e.g. ADB_COMMAND of the module.
+func PlanBuilds(valueSets []map[string]string) ([]PlannedBuild, error) {
+    cfg, err := parseConfig()
+    if err != nil {
+        return nil, err
+    }
+
+    var builds []PlannedBuild
+    for _, values := range valueSets {
+        environments := createEnvs(cfg.Environments, lookupIn(values))
+        for _, wf := range workflows(cfg) {
+            builds = append(builds, PlannedBuild{Workflow: wf, Environments: environments})
+        }
+    }
+    return builds, nil
+}
+
+func workflows(cfg Config) []string {
+    var list []string
+    for _, wf := range strings.Split(strings.TrimSpace(cfg.Workflows), "\n") {
+        list = append(list, strings.TrimSpace(wf))
+    }
+    return list
+}
+
+// TriggerWorkflow starts the workflows with the current values of the environments to share.
+func TriggerWorkflow() error {
+    environments, err := SharedEnvironments()
+    if err != nil {
+        return err
+    }
+    _, err = TriggerWorkflows([]Group{{Environments: environments}})
+    return err
+}
+
+// TriggerWorkflows starts the workflows once for every group,
+// then waits for all of the started builds if wait_for_builds is set and reports their results by group.
+// The results of the started builds are returned even if starting or waiting for the others failed,
+// they are still running if the builds were not waited for.
+func TriggerWorkflows(groups []Group) ([]Result, error) {
+    cfg, err := parseConfig()
+    if err != nil {
+        return nil, err
     }
 
     stepconf.Print(cfg)
@@ -44,38 +205,46 @@ func TriggerWorkflow() {
 
     build, err := app.GetBuild(cfg.BuildSlug)
     if err != nil {
-        util.Failf("failed to get build, error: %s", err)
+        return nil, fmt.Errorf("failed to get build, error: %s", err)
     }
 
     log.Infof("Starting builds:")
 
     var buildSlugs []string
-    environments := createEnvs(cfg.Environments)
-    for _, wf := range strings.Split(strings.TrimSpace(cfg.Workflows), "\n") {
-        wf = strings.TrimSpace(wf)
-        startedBuild, err := app.StartBuild(wf, build.OriginalBuildParams, cfg.BuildNumber, environments)
-        if err != nil {
-            util.Failf("Failed to start build, error: %s", err)
-        }
-        if startedBuild.BuildSlug == "" {
-            util.Failf("Build was not started. This could mean that manual build approval is enabled for this project and it's blocking this step from starting builds.")
+    var results []Result
+    for _, group := range groups {
+        for _, wf := range workflows(cfg) {
+            startedBuild, err := app.StartBuild(wf, build.OriginalBuildParams, cfg.BuildNumber, group.Environments)
+            if err != nil {
+                return results, fmt.Errorf("Failed to start build, error: %s", err)
+            }
+            if startedBuild.BuildSlug == "" {
+                return results, fmt.Errorf("Build was not started. This could mean that manual build approval is enabled for this project and it's blocking this step from starting builds.")
+            }
+            buildSlugs = append(buildSlugs, startedBuild.BuildSlug)
+            results = append(results, Result{Group: group.Name, Module: group.Module, Workflow: wf, BuildSlug: startedBuild.BuildSlug, Status: statusRunning})
+            log.Printf("- %s started (https://app.bitrise.io/build/%s)", startedBuild.TriggeredWorkflow, startedBuild.BuildSlug)
         }
-        buildSlugs = append(buildSlugs, startedBuild.BuildSlug)
-        log.Printf("- %s started (https://app.bitrise.io/build/%s)", startedBuild.TriggeredWorkflow, startedBuild.BuildSlug)
     }
 
-    if err := tools.ExportEnvironmentWithEnvman(envBuildSlugs, strings.Join(buildSlugs, "\n")); err != nil {
-        util.Failf("Failed to export environment variable, error: %s", err)
+    if err := execmd.ExportEnv(envBuildSlugs, strings.Join(buildSlugs, "\n")); err != nil {
+        return results, fmt.Errorf("Failed to export environment variable, error: %s", err)
     }
 
     if cfg.WaitForBuilds != "true" {
-        return
+        return results, nil
     }
 
     fmt.Println()
     log.Infof("Waiting for builds:")
 
-    if err := app.WaitForBuilds(buildSlugs, func(build bitrise.Build) {
+    waitErr := app.WaitForBuilds(buildSlugs, func(build bitrise.Build) {
+        for i := range results {
+            if results[i].BuildSlug == build.Slug {
+                results[i].Status = resultStatus(build)
+            }
+        }
+
         var failReason string
         switch build.Status {
         case 0:
@@ -126,12 +295,27 @@ func TriggerWorkflow() {
                 }
             }
         }
-    }); err != nil {
-        util.Failf("An error occoured: %s", err)
+    })
+
+    fmt.Println()
+    log.Infof("Build results:")
+    printResults(os.Stdout, results)
+    if value, err := json.Marshal(results); err != nil {
+        log.Warnf("Failed to encode the build results: %s", err)
+    } else if err := execmd.ExportEnv(envBuildResults, string(value)); err != nil {
+        log.Warnf("%s", err)
+    }
+
+    if waitErr != nil {
+        if unsuccessful := unsuccessfulResults(results); len(unsuccessful) > 0 {
+            return results, fmt.Errorf("%d of %d builds did not succeed, error: %s", len(unsuccessful), len(results), waitErr)
+        }
+        return results, fmt.Errorf("An error occoured: %s", waitErr)
     }
+    return results, nil
 }
 
-func createEnvs(environmentKeys string) []bitrise.Environment {
+func createEnvs(environmentKeys string, lookup func(string) string) []bitrise.Environment {
     environmentKeys = strings.Replace(environmentKeys, "$", "", -1)
     environmentsKeyList := strings.Split(environmentKeys, "\n")
 
@@ -143,7 +327,7 @@ func createEnvs(environmentKeys string) []bitrise.Environment {
 
         env := bitrise.Environment{
             MappedTo: key,
-            Value:    os.Getenv(key),
+            Value:    lookup(key),
         }
         environments = append(environments, env)
     }
@@ -0,0 +1,54 @@
+package trigger
+
+import (
+    "bytes"
+    "testing"
+
+    "github.com/bitrise-steplib/bitrise-step-build-router-start/bitrise"
+    "github.com/stretchr/testify/require"
+)
+
+func TestResults(t *testing.T) {
+    results := []Result{
+        {Group: "feature-login shard 1/2", Workflow: "test", BuildSlug: "a", Status: resultStatus(bitrise.Build{Status: 1})},
+        {Group: "feature-login shard 2/2", Workflow: "test", BuildSlug: "b", Status: resultStatus(bitrise.Build{Status: 2})},
+        {Workflow: "lint", BuildSlug: "c", Status: resultStatus(bitrise.Build{Status: 0})},
+    }
+
+    var out bytes.Buffer
+    printResults(&out, results)
+    require.Equal(t, `- feature-login shard 1/2: test successful
+- feature-login shard 2/2: test failed
+- lint running
+`, out.String())
+
+    require.Equal(t, results[1:], unsuccessfulResults(results))
+}
+
+func TestModuleOutcome(t *testing.T) {
+    results := []Result{
+        {Module: "feature-login", Status: statusSuccessful},
+        {Module: "feature-login", Status: "aborted"},
+        {Module: "feature-cards", Status: statusRunning},
+    }
+
+    finished, unsuccessful, total := ModuleOutcome(results, "feature-login")
+    require.True(t, finished)
+    require.Equal(t, 1, unsuccessful)
+    require.Equal(t, 2, total)
+
+    finished, _, _ = ModuleOutcome(results, "feature-cards")
+    require.False(t, finished)
+    finished, _, total = ModuleOutcome(results, "feature-profile")
+    require.False(t, finished)
+    require.Equal(t, 0, total)
+}
+
+func TestCreateEnvs(t *testing.T) {
+    t.Setenv("TARGET_APK", "app-debug.apk")
+    environments := createEnvs("$ADB_COMMAND\n$TARGET_APK\n", lookupIn(map[string]string{"ADB_COMMAND": "adb shell"}))
+    require.Equal(t, []bitrise.Environment{
+        {MappedTo: "ADB_COMMAND", Value: "adb shell"},
+        {MappedTo: "TARGET_APK", Value: "app-debug.apk"},
+    }, environments)
+}
@@ -1,11 +1,80 @@
 package util
 
 import (
-    "os"
-    "github.com/bitrise-io/go-utils/log"
+    "errors"
+    "fmt"
 )
 
-func Failf(s string, a ...interface{}) {
-    log.Errorf(s, a...)
-    os.Exit(1)
+// FailureReason classifies why the step failed, so that downstream workflows can branch on it.
+type FailureReason string
+
+const (
+    FailureUnknown    FailureReason = "unknown"
+    FailureConfig     FailureReason = "config_error"
+    FailureChanges    FailureReason = "change_detection_failed"
+    FailureBuild      FailureReason = "build_failed"
+    FailureUpload     FailureReason = "upload_failed"
+    FailureTrigger    FailureReason = "trigger_failed"
+)
+
+var exitCodes = map[FailureReason]int{
+    FailureUnknown: 1,
+    FailureConfig:  2,
+    FailureChanges: 3,
+    FailureBuild:   4,
+    FailureUpload:  5,
+    FailureTrigger: 6,
+}
+
+// StepError is an error with the reason of the failure.
+type StepError struct {
+    Reason    FailureReason
+    Err       error
+}
+
+func (e *StepError) Error() string {
+    return e.Err.Error()
+}
+
+func (e *StepError) Unwrap() error {
+    return e.Err
+}
+
+// Errorf returns a formatted error with the reason of the failure.
+func Errorf(reason FailureReason, format string, a ...interface{}) error {
+    return &StepError{Reason: reason, Err: fmt.Errorf(format, a...)}
+}
+
+// ConfigErrorf returns a formatted error caused by an invalid input.
+func ConfigErrorf(format string, a ...interface{}) error {
+    return Errorf(FailureConfig, format, a...)
+}
+
+// Classify attaches the reason to the error, unless it already has one.
+func Classify(reason FailureReason, err error) error {
+    if err == nil {
+        return nil
+    }
+    var stepErr *StepError
+    if errors.As(err, &stepErr) {
+        return err
+    }
+    return &StepError{Reason: reason, Err: err}
+}
+
+// Reason returns the reason of the failure, FailureUnknown if the error has none.
+func Reason(err error) FailureReason {
+    var stepErr *StepError
+    if errors.As(err, &stepErr) {
+        return stepErr.Reason
+    }
+    return FailureUnknown
+}
+
+// ExitCode returns the process exit code of the failure.
+func ExitCode(err error) int {
+    if code, ok := exitCodes[Reason(err)]; ok {
+        return code
+    }
+    return exitCodes[FailureUnknown]
 }
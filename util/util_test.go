@@ -0,0 +1,27 @@
+package util
+
+import (
+    "errors"
+    "fmt"
+    "testing"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+    configErr := ConfigErrorf("Issue with an input: %s", "module")
+    wrapped := fmt.Errorf("failed to load layout: %w", configErr)
+
+    require.Equal(t, FailureConfig, Reason(wrapped))
+    require.Equal(t, 2, ExitCode(wrapped))
+    require.Equal(t, wrapped, Classify(FailureBuild, wrapped))
+
+    buildErr := Classify(FailureBuild, errors.New("gradle failed"))
+    require.Equal(t, FailureBuild, Reason(buildErr))
+    require.Equal(t, 4, ExitCode(buildErr))
+    require.Equal(t, "gradle failed", buildErr.Error())
+
+    require.Equal(t, FailureUnknown, Reason(errors.New("boom")))
+    require.Equal(t, 1, ExitCode(errors.New("boom")))
+    require.Nil(t, Classify(FailureBuild, nil))
+}